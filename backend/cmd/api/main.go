@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"go-azure/config"
 	"go-azure/controllers"
 	"go-azure/middleware"
@@ -26,26 +28,78 @@ func main() {
 		logger.WithError(err).Fatal("Failed to initialize database")
 	}
 
+	// Load JWT signing keys
+	signingKeys, err := utils.LoadSigningKeys(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to load JWT signing keys")
+	}
+
+	// Initialize token revocation store
+	revocationStore := services.NewRevocationStore(cfg)
+
+	// Initialize blob storage for avatars
+	blobStore, err := services.NewBlobStore(cfg)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize blob storage")
+	}
+
 	// Initialize services
-	authService := services.NewAuthService(cfg)
+	authService := services.NewAuthService(cfg, revocationStore, signingKeys, blobStore)
 	postService := services.NewPostService()
+	commentService := services.NewCommentService(postService)
+	reactionService := services.NewReactionService(postService)
+	userService := services.NewUserService()
+	tokenService := services.NewTokenService()
+	rateLimitStore := services.NewRateLimitStore(cfg)
+	mfaService := services.NewMFAService(cfg, authService, rateLimitStore)
+
+	// Purge expired revocations, login states, login codes, MFA challenges and rate limits in the background
+	purgeInterval := time.Duration(cfg.PurgeIntervalMinutes) * time.Minute
+	services.StartJanitor("revoked_tokens", purgeInterval, revocationStore.PurgeExpired)
+	services.StartJanitor("oauth_states", purgeInterval, authService.PurgeExpiredLoginStates)
+	services.StartJanitor("login_codes", purgeInterval, authService.PurgeExpiredLoginCodes)
+	services.StartJanitor("mfa_challenges", purgeInterval, mfaService.PurgeExpiredChallenges)
+	services.StartJanitor("rate_limits", purgeInterval, rateLimitStore.PurgeExpired)
 
 	// Initialize middleware
-	authMiddleware := middleware.NewAuthMiddleware(authService)
+	sessionCookies := middleware.NewSessionCookies(cfg)
+	authMiddleware := middleware.NewAuthMiddleware(authService, tokenService, sessionCookies)
+	rateLimiter := middleware.NewRateLimiter(rateLimitStore, cfg)
 
 	// Initialize controllers
-	authController := controllers.NewAuthController(authService, cfg)
+	authController := controllers.NewAuthController(authService, mfaService, authMiddleware, sessionCookies, rateLimiter, cfg)
 	postController := controllers.NewPostController(postService, authMiddleware)
+	commentController := controllers.NewCommentController(commentService, authMiddleware)
+	reactionController := controllers.NewReactionController(reactionService, authMiddleware)
+	adminController := controllers.NewAdminController(userService, authService, authMiddleware, cfg)
+	tokenController := controllers.NewTokenController(tokenService, userService, authMiddleware)
+	userController := controllers.NewUserController(userService, authMiddleware)
+	mfaController := controllers.NewMFAController(mfaService, authMiddleware, sessionCookies, rateLimiter, cfg)
+
+	// Local username/password authentication is opt-in
+	var localAuthController *controllers.LocalAuthController
+	if cfg.LocalAuthEnabled {
+		localAuthService := services.NewLocalAuthService(cfg, authService, services.NewMailer(cfg), rateLimitStore)
+		services.StartJanitor("password_reset_tokens", purgeInterval, localAuthService.PurgeExpiredResetTokens)
+		services.StartJanitor("email_verification_tokens", purgeInterval, localAuthService.PurgeExpiredVerificationTokens)
+		localAuthController = controllers.NewLocalAuthController(localAuthService, authService, authController, rateLimiter)
+	}
 
 	// Initialize router
 	router := gin.Default()
 
+	// Client IPs key the rate limits, so only believe forwarding headers from known proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logger.WithError(err).Fatal("Invalid trusted proxies")
+	}
+
 	// Add CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", cfg.AppURL)
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, X-Device-ID, Authorization, accept, origin, Cache-Control, X-Requested-With")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "Retry-After")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -55,6 +109,9 @@ func main() {
 		c.Next()
 	})
 
+	// Enforce double-submit CSRF protection for cookie-authenticated requests
+	router.Use(sessionCookies.RequireCSRF())
+
 	// Add middleware for logging
 	router.Use(func(c *gin.Context) {
 		// Log request
@@ -77,6 +134,20 @@ func main() {
 	// Register routes
 	authController.RegisterRoutes(router)
 	postController.RegisterRoutes(router)
+	commentController.RegisterRoutes(router)
+	reactionController.RegisterRoutes(router)
+	adminController.RegisterRoutes(router)
+	tokenController.RegisterRoutes(router)
+	userController.RegisterRoutes(router)
+	mfaController.RegisterRoutes(router)
+	if localAuthController != nil {
+		localAuthController.RegisterRoutes(router)
+	}
+
+	// Serve files from the local blob store
+	if cfg.BlobStoreDriver == "local" {
+		router.Static(services.LocalBlobPath, cfg.BlobStoreDir)
+	}
 
 	// Add health check endpoint
 	router.GET("/health", func(c *gin.Context) {
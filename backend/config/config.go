@@ -1,7 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
@@ -11,13 +14,75 @@ import (
 type Config struct {
 	Host                  string
 	Port                  string
-	JWTSecret             string
+	JWTKeysDir            string
+	JWTActiveKeyID        string
 	JWTExpirationMinutes  int
+	RefreshTokenTTLDays   int
 	MicrosoftClientID     string
 	MicrosoftClientSecret string
 	MicrosoftRedirectURI  string
 	MicrosoftTenantID     string
+	MicrosoftAuthority    string
+	MicrosoftGraphURL     string
 	AppURL                string
+	OIDCProviders         []OIDCProviderConfig
+	AdminEmails           []string
+	OAuthStateTTLMinutes  int
+	LoginCodeTTLSeconds   int
+
+	// How clients hold their session: "bearer" tokens in the response body,
+	// or "cookie" for HttpOnly cookies with double-submit CSRF protection
+	AuthMode       string
+	CookieDomain   string
+	CookieSecure   bool
+	CookieSameSite string
+
+	// Sign-in restrictions. Empty allowlists allow everyone.
+	AllowedTenantIDs    []string
+	AllowedEmailDomains []string
+	InviteOnly          bool
+
+	// Local username/password authentication
+	LocalAuthEnabled            bool
+	PasswordResetTTLMinutes     int
+	EmailVerificationTTLMinutes int
+
+	// Two-factor authentication
+	MFAIssuer              string
+	MFAChallengeTTLMinutes int
+	MFAMaxAgeMinutes       int
+
+	// Blob storage for uploaded and synced files ("local")
+	BlobStoreDriver string
+	BlobStoreDir    string
+	PublicURL       string
+
+	// Mailer configuration ("log" or "smtp")
+	MailerDriver string
+	MailFrom     string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// Token revocation configuration ("database" or "memory")
+	RevocationStore string
+	// PurgeIntervalMinutes controls how often expired revocations, OAuth states and login codes are
+	// removed; 0 disables purging
+	PurgeIntervalMinutes int
+
+	// Rate limiting of authentication endpoints ("database" or "memory" store), disabled
+	// when AUTH_RATE_LIMIT_PER_MINUTE is 0
+	RateLimitStore         string
+	AuthRateLimitPerMinute int
+	// Per-account limit on logins, second factors and account emails, whatever the client
+	// IP; disabled when AUTH_ACCOUNT_RATE_LIMIT_PER_MINUTE is 0
+	AuthAccountRateLimitPerMinute int
+	LoginMaxFailures              int
+	LoginLockoutMaxMinutes        int
+	// TrustedProxies lists the proxies whose X-Forwarded-For header is believed when
+	// determining the client IP; empty trusts none
+	TrustedProxies []string
 
 	// Database configuration
 	DBHost     string
@@ -27,6 +92,23 @@ type Config struct {
 	DBName     string
 }
 
+// OIDCProviderConfig holds the configuration of a generic OAuth2/OIDC identity provider
+type OIDCProviderConfig struct {
+	Name               string
+	ClientID           string
+	ClientSecret       string
+	RedirectURI        string
+	Issuer             string
+	AuthURL            string
+	TokenURL           string
+	UserInfoURL        string
+	Scopes             []string
+	SubjectClaim       string
+	EmailClaim         string
+	NameClaim          string
+	EmailVerifiedClaim string
+}
+
 // LoadConfig loads configuration from environment variables
 func LoadConfig() *Config {
 	// Load .env file if it exists
@@ -36,13 +118,67 @@ func LoadConfig() *Config {
 	config := &Config{
 		Host:                  getEnv("HOST", ""),
 		Port:                  getEnv("PORT", "8080"),
-		JWTSecret:             getEnv("JWT_SECRET", "your-secret-key"),
-		JWTExpirationMinutes:  60, // 1 hour
+		JWTKeysDir:            getEnv("JWT_KEYS_DIR", ""),
+		JWTActiveKeyID:        getEnv("JWT_ACTIVE_KEY_ID", ""),
+		JWTExpirationMinutes:  getEnvInt("JWT_EXPIRATION_MINUTES", 60), // 1 hour
+		RefreshTokenTTLDays:   getEnvInt("REFRESH_TOKEN_TTL_DAYS", 30),
 		MicrosoftClientID:     getEnv("MICROSOFT_CLIENT_ID", ""),
 		MicrosoftClientSecret: getEnv("MICROSOFT_CLIENT_SECRET", ""),
 		MicrosoftRedirectURI:  getEnv("MICROSOFT_REDIRECT_URI", "http://localhost:8080/auth/microsoft/callback"),
 		MicrosoftTenantID:     getEnv("MICROSOFT_TENANT_ID", "common"),
+		MicrosoftAuthority:    getEnv("MICROSOFT_AUTHORITY", "https://login.microsoftonline.com"),
+		MicrosoftGraphURL:     getEnv("MICROSOFT_GRAPH_URL", "https://graph.microsoft.com/v1.0"),
 		AppURL:                getEnv("APP_URL", "http://localhost:3000"),
+		OIDCProviders:         loadOIDCProviders(),
+		AdminEmails:           getEnvList("ADMIN_EMAILS"),
+		OAuthStateTTLMinutes:  getEnvInt("OAUTH_STATE_TTL_MINUTES", 10),
+		LoginCodeTTLSeconds:   getEnvInt("LOGIN_CODE_TTL_SECONDS", 60),
+
+		// Session delivery
+		AuthMode:       getEnv("AUTH_MODE", "bearer"),
+		CookieDomain:   getEnv("COOKIE_DOMAIN", ""),
+		CookieSecure:   getEnvBool("COOKIE_SECURE", true),
+		CookieSameSite: getEnv("COOKIE_SAME_SITE", "lax"),
+
+		// Sign-in restrictions
+		AllowedTenantIDs:    getEnvList("ALLOWED_TENANT_IDS"),
+		AllowedEmailDomains: getEnvList("ALLOWED_EMAIL_DOMAINS"),
+		InviteOnly:          getEnvBool("INVITE_ONLY", false),
+
+		// Local username/password authentication
+		LocalAuthEnabled:            getEnvBool("LOCAL_AUTH_ENABLED", false),
+		PasswordResetTTLMinutes:     getEnvInt("PASSWORD_RESET_TTL_MINUTES", 30),
+		EmailVerificationTTLMinutes: getEnvInt("EMAIL_VERIFICATION_TTL_MINUTES", 1440),
+
+		// Two-factor authentication
+		MFAIssuer:              getEnv("MFA_ISSUER", "Generic Social Media"),
+		MFAChallengeTTLMinutes: getEnvInt("MFA_CHALLENGE_TTL_MINUTES", 5),
+		MFAMaxAgeMinutes:       getEnvInt("MFA_MAX_AGE_MINUTES", 15),
+
+		// Blob storage
+		BlobStoreDriver: getEnv("BLOB_STORE_DRIVER", "local"),
+		BlobStoreDir:    getEnv("BLOB_STORE_DIR", "./data/blobs"),
+		PublicURL:       getEnv("PUBLIC_URL", "http://localhost:8080"),
+
+		// Mailer configuration
+		MailerDriver: getEnv("MAILER_DRIVER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "no-reply@localhost"),
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnv("SMTP_PORT", "587"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+
+		// Token revocation configuration
+		RevocationStore:      getEnv("REVOCATION_STORE", "database"),
+		PurgeIntervalMinutes: getEnvInt("PURGE_INTERVAL_MINUTES", 15),
+
+		// Rate limiting
+		RateLimitStore:                getEnv("RATE_LIMIT_STORE", "database"),
+		AuthRateLimitPerMinute:        getEnvInt("AUTH_RATE_LIMIT_PER_MINUTE", 20),
+		AuthAccountRateLimitPerMinute: getEnvInt("AUTH_ACCOUNT_RATE_LIMIT_PER_MINUTE", 10),
+		LoginMaxFailures:              getEnvInt("LOGIN_MAX_FAILURES", 5),
+		LoginLockoutMaxMinutes:        getEnvInt("LOGIN_LOCKOUT_MAX_MINUTES", 15),
+		TrustedProxies:                getEnvList("TRUSTED_PROXIES"),
 
 		// Database configuration
 		DBHost:     getEnv("DB_HOST", "localhost"),
@@ -58,6 +194,34 @@ func LoadConfig() *Config {
 	return config
 }
 
+// loadOIDCProviders loads the providers listed in OIDC_PROVIDERS (e.g. "google,github"),
+// each configured through OIDC_<NAME>_* environment variables. Providers with an ISSUER
+// use OpenID Connect discovery; plain OAuth2 providers set the endpoint URLs explicitly.
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+
+	for _, name := range getEnvList("OIDC_PROVIDERS") {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			Name:               name,
+			ClientID:           getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret:       getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURI:        getEnv(prefix+"REDIRECT_URI", fmt.Sprintf("http://localhost:8080/auth/%s/callback", name)),
+			Issuer:             getEnv(prefix+"ISSUER", ""),
+			AuthURL:            getEnv(prefix+"AUTH_URL", ""),
+			TokenURL:           getEnv(prefix+"TOKEN_URL", ""),
+			UserInfoURL:        getEnv(prefix+"USERINFO_URL", ""),
+			Scopes:             strings.Fields(getEnv(prefix+"SCOPES", "openid profile email")),
+			SubjectClaim:       getEnv(prefix+"SUBJECT_CLAIM", "sub"),
+			EmailClaim:         getEnv(prefix+"EMAIL_CLAIM", "email"),
+			NameClaim:          getEnv(prefix+"NAME_CLAIM", "name"),
+			EmailVerifiedClaim: getEnv(prefix+"EMAIL_VERIFIED_CLAIM", "email_verified"),
+		})
+	}
+
+	return providers
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -66,3 +230,32 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
+
+// getEnvInt gets an integer environment variable or returns a default value
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvBool gets a boolean environment variable or returns a default value
+func getEnvBool(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// getEnvList gets a comma-separated environment variable as a list of trimmed, non-empty values
+func getEnvList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go-azure/config"
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// AdminController handles user administration endpoints
+type AdminController struct {
+	userService    *services.UserService
+	authService    *services.AuthService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+	config         *config.Config
+}
+
+// NewAdminController creates a new AdminController
+func NewAdminController(userService *services.UserService, authService *services.AuthService, authMiddleware *middleware.AuthMiddleware, config *config.Config) *AdminController {
+	return &AdminController{
+		userService:    userService,
+		authService:    authService,
+		authMiddleware: authMiddleware,
+		logger:         utils.GetLogger(),
+		config:         config,
+	}
+}
+
+// updateRoleRequest is the request body for the role update endpoint
+type updateRoleRequest struct {
+	Role models.Role `json:"role" binding:"required"`
+}
+
+// createUserRequest is the request body for the user provisioning endpoint
+type createUserRequest struct {
+	Email    string      `json:"email" binding:"required,email,max=255"`
+	Username string      `json:"username" binding:"max=50"`
+	Role     models.Role `json:"role"`
+}
+
+// RegisterRoutes registers the routes for the AdminController
+func (c *AdminController) RegisterRoutes(router *gin.Engine) {
+	admin := router.Group("/admin")
+	admin.Use(
+		c.authMiddleware.RequireAuth(),
+		c.authMiddleware.RequireScope(models.ScopeAdmin),
+		c.authMiddleware.RequirePermission(models.PermissionManageUsers),
+	)
+	{
+		// Granting access requires a recent second factor. Revoking sessions does not,
+		// so it stays available to admin personal access tokens.
+		requireRecentMFA := c.authMiddleware.RequireRecentMFA(time.Duration(c.config.MFAMaxAgeMinutes) * time.Minute)
+		admin.POST("/users", requireRecentMFA, c.CreateUser)
+		admin.PUT("/users/:id/role", requireRecentMFA, c.UpdateUserRole)
+		admin.POST("/users/:id/sessions/revoke", c.RevokeUserSessions)
+	}
+}
+
+// CreateUser provisions a user so they can sign in when invite-only mode is enabled
+func (c *AdminController) CreateUser(ctx *gin.Context) {
+	// Parse request body
+	var req createUserRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Role == "" {
+		req.Role = models.RoleUser
+	}
+
+	// Create user
+	user, err := c.userService.CreateUser(req.Email, req.Username, req.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRole):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserExists):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"admin_id": ctx.GetString("user_id"),
+		"user_id":  user.ID,
+		"role":     user.Role,
+	}).Info("Admin provisioned user")
+
+	ctx.JSON(http.StatusCreated, gin.H{"user": user})
+}
+
+// UpdateUserRole changes the role of a user
+func (c *AdminController) UpdateUserRole(ctx *gin.Context) {
+	// Get user ID from URL
+	userID := ctx.Param("id")
+
+	// Parse request body
+	var req updateRoleRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Update role
+	user, err := c.userService.UpdateRole(userID, req.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRole):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	// Access tokens carry the role, so end existing sessions for the new role to take effect
+	if err := c.authService.RevokeAllUserTokens(userID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"admin_id": ctx.GetString("user_id"),
+		"user_id":  userID,
+		"role":     req.Role,
+	}).Info("Admin changed user role")
+
+	ctx.JSON(http.StatusOK, gin.H{"user": user})
+}
+
+// RevokeUserSessions terminates every session of a user
+func (c *AdminController) RevokeUserSessions(ctx *gin.Context) {
+	// Get user ID from URL
+	userID := ctx.Param("id")
+
+	// Make sure the user exists
+	if _, err := c.userService.GetUserByID(userID); err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Revoke sessions
+	if err := c.authService.RevokeAllUserTokens(userID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"admin_id": ctx.GetString("user_id"),
+		"user_id":  userID,
+	}).Info("Admin revoked all user sessions")
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "All sessions revoked successfully"})
+}
@@ -1,81 +1,150 @@
 package controllers
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"go-azure/config"
+	"go-azure/middleware"
+	"go-azure/models"
 	"go-azure/services"
 	"go-azure/utils"
 )
 
 // AuthController handles authentication endpoints
 type AuthController struct {
-	authService *services.AuthService
-	logger      *logrus.Logger
-	config      *config.Config
+	authService    *services.AuthService
+	mfaService     *services.MFAService
+	authMiddleware *middleware.AuthMiddleware
+	sessionCookies *middleware.SessionCookies
+	rateLimiter    *middleware.RateLimiter
+	logger         *logrus.Logger
+	config         *config.Config
 }
 
 // NewAuthController creates a new AuthController
-func NewAuthController(authService *services.AuthService, config *config.Config) *AuthController {
+func NewAuthController(authService *services.AuthService, mfaService *services.MFAService, authMiddleware *middleware.AuthMiddleware, sessionCookies *middleware.SessionCookies, rateLimiter *middleware.RateLimiter, config *config.Config) *AuthController {
 	return &AuthController{
-		authService: authService,
-		logger:      utils.GetLogger(),
-		config:      config,
+		authService:    authService,
+		mfaService:     mfaService,
+		authMiddleware: authMiddleware,
+		sessionCookies: sessionCookies,
+		rateLimiter:    rateLimiter,
+		logger:         utils.GetLogger(),
+		config:         config,
 	}
 }
 
 // RegisterRoutes registers the routes for the AuthController
 func (c *AuthController) RegisterRoutes(router *gin.Engine) {
+	router.GET("/.well-known/jwks.json", c.JWKS)
+
 	auth := router.Group("/auth")
 	{
-		auth.GET("/microsoft", c.MicrosoftLogin)
-		auth.GET("/microsoft/callback", c.MicrosoftCallback)
-		auth.POST("/signout", c.SignOut)
+		auth.GET("/:provider", c.rateLimiter.ByIP("oauth"), c.Login)
+		auth.GET("/:provider/callback", c.rateLimiter.ByIP("oauth"), c.Callback)
+		auth.POST("/exchange", c.rateLimiter.ByIP("token"), c.Exchange)
+		auth.POST("/refresh", c.rateLimiter.ByIP("token"), c.Refresh)
+		auth.POST("/signout", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireInteractiveAuth(), c.SignOut)
+		auth.POST("/signout/all", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireInteractiveAuth(), c.SignOutAll)
+		auth.GET("/sessions", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireInteractiveAuth(), c.ListSessions)
+		auth.DELETE("/sessions/:id", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireInteractiveAuth(), c.RevokeSession)
+		auth.GET("/identities", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireInteractiveAuth(), c.ListIdentities)
+		auth.POST("/identities/:provider", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireInteractiveAuth(), c.LinkIdentity)
+		auth.DELETE("/identities/:id", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireInteractiveAuth(), c.UnlinkIdentity)
 	}
 }
 
-// MicrosoftLogin returns Microsoft OAuth login URL
-func (c *AuthController) MicrosoftLogin(ctx *gin.Context) {
-	// Generate state for CSRF protection
-	state, err := c.authService.GenerateState()
+// exchangeRequest is the request body for the login code exchange endpoint
+type exchangeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// refreshRequest is the request body for the refresh endpoint. In cookie auth mode
+// the refresh token is read from its cookie when the body does not contain one.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// JWKS publishes the public keys our JWTs are signed with, so other services can verify them
+func (c *AuthController) JWKS(ctx *gin.Context) {
+	keySet, err := c.authService.JWKS()
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to build JWKS")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load signing keys"})
+		return
+	}
+
+	ctx.Header("Cache-Control", "public, max-age=300")
+	ctx.JSON(http.StatusOK, keySet)
+}
+
+// Login returns the identity provider's OAuth login URL
+func (c *AuthController) Login(ctx *gin.Context) {
+	// Get identity provider from URL
+	provider, err := c.authService.GetProvider(ctx.Param("provider"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Generate and store state for CSRF protection, the nonce and the PKCE verifier, bound to the post-login redirect
+	state, loginState, err := c.authService.CreateLoginState(provider.Name(), sanitizeRedirect(ctx.Query("redirect")), "")
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to generate state")
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate login"})
 		return
 	}
 
-	// Store state in cookie
-	ctx.SetCookie("oauth_state", state, 3600, "/", "", false, true)
-
-	// Get Microsoft login URL
-	loginURL := c.authService.GetMicrosoftLoginURL(state)
+	// Get provider login URL
+	loginURL, err := provider.LoginURL(ctx.Request.Context(), state, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to build login URL")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate login"})
+		return
+	}
 
 	// Return the login URL as JSON
 	ctx.JSON(http.StatusOK, gin.H{"login_url": loginURL})
 }
 
-// MicrosoftCallback handles the callback from Microsoft OAuth
-func (c *AuthController) MicrosoftCallback(ctx *gin.Context) {
-	////Get state from cookie
-	//stateCookie, err := ctx.Cookie("oauth_state")
-	//if err != nil {
-	//	c.logger.WithError(err).Error("Failed to get state cookie")
-	//	ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
-	//	return
-	//}
-	//
-	////Verify state
-	//state := ctx.Query("state")
-	//if state != stateCookie {
-	//	c.logger.Error("State mismatch")
-	//	ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
-	//	return
-	//}
+// Callback handles the callback from the identity provider
+func (c *AuthController) Callback(ctx *gin.Context) {
+	// Get identity provider from URL
+	provider, err := c.authService.GetProvider(ctx.Param("provider"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Verify state, which must have been issued for this provider
+	loginState, err := c.authService.ConsumeLoginState(ctx.Query("state"))
+	if err != nil || loginState.Provider != provider.Name() {
+		c.logger.WithError(err).Warn("Invalid OAuth state")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		return
+	}
+
+	// The provider reports a cancelled or failed login with an error instead of a code
+	if providerError := ctx.Query("error"); providerError != "" {
+		c.logger.WithFields(logrus.Fields{
+			"provider":    provider.Name(),
+			"error":       providerError,
+			"description": ctx.Query("error_description"),
+		}).Warn("Provider returned an error")
+		if loginState.LinkUserID != "" {
+			c.redirectToApp(ctx, loginState.RedirectTo, url.Values{"error": {providerError}})
+			return
+		}
+		c.redirectToLogin(ctx, url.Values{"error": {providerError}})
+		return
+	}
 
 	// Get code
 	code := ctx.Query("code")
@@ -85,68 +154,388 @@ func (c *AuthController) MicrosoftCallback(ctx *gin.Context) {
 		return
 	}
 
-	// Exchange code for token
-	tokenDetails, user, err := c.authService.HandleMicrosoftCallback(code)
+	// Logins started from LinkIdentity attach the account to the signed-in user instead
+	if loginState.LinkUserID != "" {
+		c.completeLink(ctx, provider, code, loginState)
+		return
+	}
+
+	// Exchange code for token and resolve the user
+	user, err := c.authService.HandleProviderCallback(ctx.Request.Context(), provider, code, loginState)
 	if err != nil {
-		c.logger.WithError(err).Error("Failed to handle Microsoft callback")
+		// Send rejected sign-ins back to the login page with an error code it can display
+		if errorCode := signInErrorCode(err); errorCode != "" {
+			c.redirectToLogin(ctx, url.Values{"error": {errorCode}})
+			return
+		}
+		c.logger.WithError(err).Error("Failed to handle provider callback")
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate"})
 		return
 	}
 
-	// Clear state cookie
-	//ctx.SetCookie("oauth_state", "", -1, "/", "", false, true)
-
 	// Log successful login
 	c.logger.WithFields(logrus.Fields{
-		"user_id": user.ID,
-		"email":   user.Email,
+		"user_id":  user.ID,
+		"email":    user.Email,
+		"provider": provider.Name(),
 	}).Info("User logged in")
 
-	// Convert token and user to JSON
-	tokenJSON, err := json.Marshal(tokenDetails)
+	// Issue a one-time login code instead of exposing tokens in the URL
+	loginCode, err := c.authService.CreateLoginCode(user.ID)
 	if err != nil {
-		c.logger.WithError(err).Error("Failed to marshal token")
+		c.logger.WithError(err).Error("Failed to create login code")
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication"})
 		return
 	}
 
-	userJSON, err := json.Marshal(user)
+	// Redirect to frontend application, which redeems the code at /auth/exchange
+	c.redirectToLogin(ctx, url.Values{
+		"code":     {loginCode},
+		"redirect": {loginState.RedirectTo},
+	})
+}
+
+// completeLink links the provider account to the user who started the link and
+// returns to the frontend page the link was started from
+func (c *AuthController) completeLink(ctx *gin.Context, provider services.IdentityProvider, code string, loginState *models.OAuthState) {
+	_, err := c.authService.LinkProviderIdentity(ctx.Request.Context(), provider, code, loginState)
 	if err != nil {
-		c.logger.WithError(err).Error("Failed to marshal user")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication"})
+		errorCode := signInErrorCode(err)
+		if errorCode == "" {
+			c.logger.WithError(err).Error("Failed to link identity")
+			errorCode = "link_failed"
+		}
+		c.redirectToApp(ctx, loginState.RedirectTo, url.Values{"error": {errorCode}})
 		return
 	}
 
-	// Build redirect URL with token and user data as query parameters
-	redirectURL, err := url.Parse(fmt.Sprintf("%s/login", c.config.AppURL))
+	c.redirectToApp(ctx, loginState.RedirectTo, url.Values{"linked": {provider.Name()}})
+}
+
+// redirectToLogin redirects to the frontend login page with the given query parameters
+func (c *AuthController) redirectToLogin(ctx *gin.Context, query url.Values) {
+	c.redirectToApp(ctx, "/login", query)
+}
+
+// redirectToApp redirects to a frontend path with the given query parameters
+func (c *AuthController) redirectToApp(ctx *gin.Context, path string, query url.Values) {
+	redirectURL, err := url.Parse(fmt.Sprintf("%s%s", c.config.AppURL, path))
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to parse frontend URL")
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication"})
 		return
 	}
 
-	query := redirectURL.Query()
-	query.Set("token", string(tokenJSON))
-	query.Set("user", string(userJSON))
-	redirectURL.RawQuery = query.Encode()
-
-	// Redirect to frontend application with token and user data
+	// Keep any query parameters already on the path, such as those of a post-login redirect
+	merged := redirectURL.Query()
+	for key, values := range query {
+		merged[key] = values
+	}
+	redirectURL.RawQuery = merged.Encode()
 	ctx.Redirect(http.StatusTemporaryRedirect, redirectURL.String())
 }
 
-// SignOut handles user sign out
+// Exchange redeems a one-time login code for the user's tokens
+func (c *AuthController) Exchange(ctx *gin.Context) {
+	// Parse request body
+	var req exchangeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Redeem login code
+	user, err := c.authService.RedeemLoginCode(req.Code)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidLoginCode) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.WithError(err).Error("Failed to redeem login code")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication"})
+		return
+	}
+
+	c.signIn(ctx, user, []string{models.AuthMethodFederated})
+}
+
+// signIn responds with the tokens of a completed primary login, or with an MFA
+// challenge to redeem at /auth/mfa/challenge when the user has TOTP enabled
+func (c *AuthController) signIn(ctx *gin.Context, user *models.User, authMethods []string) {
+	tokenDetails, mfaToken, err := c.mfaService.SignIn(user, deviceInfo(ctx), authMethods)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to sign in")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication"})
+		return
+	}
+
+	if mfaToken != "" {
+		ctx.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": mfaToken})
+		return
+	}
+
+	respondWithTokens(ctx, c.sessionCookies, http.StatusOK, tokenDetails, user)
+}
+
+// respondWithTokens sends the tokens of a login, refresh or step-up. In cookie auth mode they
+// are set as HttpOnly cookies and left out of the body, which carries the CSRF token instead.
+func respondWithTokens(ctx *gin.Context, sessionCookies *middleware.SessionCookies, status int, tokenDetails *models.TokenDetails, user *models.User) {
+	body := gin.H{"token": tokenDetails}
+	if user != nil {
+		body["user"] = user
+	}
+
+	if sessionCookies.Enabled() {
+		csrfToken, err := sessionCookies.Set(ctx, tokenDetails)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication"})
+			return
+		}
+
+		withoutTokens := *tokenDetails
+		withoutTokens.AccessToken = ""
+		withoutTokens.RefreshToken = ""
+		body["token"] = withoutTokens
+		body["csrf_token"] = csrfToken
+	}
+
+	ctx.JSON(status, body)
+}
+
+// respondIfThrottled answers 429 with a Retry-After header when err is a lockout
+// from repeated failed attempts, and reports whether it did
+func respondIfThrottled(ctx *gin.Context, err error) bool {
+	var throttled *services.ThrottledError
+	if !errors.As(err, &throttled) {
+		return false
+	}
+	middleware.RespondThrottled(ctx, throttled.RetryAfter)
+	return true
+}
+
+// Refresh exchanges a refresh token for a new JWT and a rotated refresh token
+func (c *AuthController) Refresh(ctx *gin.Context) {
+	// Parse request body, which may be empty in cookie auth mode
+	var req refreshRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// In cookie auth mode the refresh token comes from its cookie
+	if req.RefreshToken == "" && c.sessionCookies.Enabled() {
+		req.RefreshToken, _ = ctx.Cookie(middleware.RefreshTokenCookie)
+	}
+	if req.RefreshToken == "" {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "refresh token is required"})
+		return
+	}
+
+	// Rotate refresh token
+	tokenDetails, user, err := c.authService.RefreshTokens(req.RefreshToken, deviceInfo(ctx))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			if c.sessionCookies.Enabled() {
+				c.sessionCookies.Clear(ctx)
+			}
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.WithError(err).Error("Failed to refresh token")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	respondWithTokens(ctx, c.sessionCookies, http.StatusOK, tokenDetails, user)
+}
+
+// SignOut revokes the current session with its access and refresh tokens
 func (c *AuthController) SignOut(ctx *gin.Context) {
-	// In a stateless JWT authentication system, the client is responsible for
-	// discarding the token. The server doesn't need to do anything special.
-	// However, in a real application, you might want to blacklist the token.
+	// Get session from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+	sessionID := ctx.GetString("session_id")
 
-	// Get user ID from context (set by auth middleware)
-	userID, exists := ctx.Get("user_id")
-	if exists {
-		c.logger.WithFields(logrus.Fields{
-			"user_id": userID,
-		}).Info("User signed out")
+	if err := c.authService.RevokeSession(userID, sessionID); err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+		c.logger.WithError(err).Error("Failed to sign out")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign out"})
+		return
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+	}).Info("User signed out")
+
+	if c.sessionCookies.Enabled() {
+		c.sessionCookies.Clear(ctx)
 	}
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Successfully signed out"})
 }
+
+// SignOutAll revokes every token issued to the authenticated user
+func (c *AuthController) SignOutAll(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	if err := c.authService.RevokeAllUserTokens(userID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to sign out"})
+		return
+	}
+
+	if c.sessionCookies.Enabled() {
+		c.sessionCookies.Clear(ctx)
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Successfully signed out of all sessions"})
+}
+
+// ListSessions returns the active sessions of the authenticated user
+func (c *AuthController) ListSessions(ctx *gin.Context) {
+	// Get user and session from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+	sessionID := ctx.GetString("session_id")
+
+	sessions, err := c.authService.ListSessions(userID, sessionID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// RevokeSession signs one of the authenticated user's devices out
+func (c *AuthController) RevokeSession(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get session ID from URL
+	sessionID := ctx.Param("id")
+
+	if err := c.authService.RevokeSession(userID, sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// ListIdentities returns the identities linked to the authenticated user
+func (c *AuthController) ListIdentities(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	identities, err := c.authService.ListIdentities(userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"identities": identities})
+}
+
+// LinkIdentity returns the identity provider's login URL for linking another account
+// to the authenticated user. The callback returns to the redirect path afterwards.
+func (c *AuthController) LinkIdentity(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get identity provider from URL
+	provider, err := c.authService.GetProvider(ctx.Param("provider"))
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Generate and store state bound to the user the identity will be linked to
+	state, loginState, err := c.authService.CreateLoginState(provider.Name(), sanitizeRedirect(ctx.Query("redirect")), userID)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to generate state")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate link"})
+		return
+	}
+
+	// Get provider login URL
+	loginURL, err := provider.LoginURL(ctx.Request.Context(), state, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to build login URL")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initiate link"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"login_url": loginURL})
+}
+
+// UnlinkIdentity removes an identity from the authenticated user
+func (c *AuthController) UnlinkIdentity(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	if err := c.authService.UnlinkIdentity(userID, ctx.Param("id")); err != nil {
+		switch {
+		case errors.Is(err, services.ErrIdentityNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrLastIdentity):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Identity unlinked successfully"})
+}
+
+// signInErrorCode returns the error code shown by the frontend for a rejected sign-in,
+// or an empty string if err is not a sign-in rejection
+func signInErrorCode(err error) string {
+	switch {
+	case errors.Is(err, services.ErrTenantNotAllowed):
+		return "tenant_not_allowed"
+	case errors.Is(err, services.ErrDomainNotAllowed):
+		return "domain_not_allowed"
+	case errors.Is(err, services.ErrDomainUnverified):
+		return "domain_unverified"
+	case errors.Is(err, services.ErrNotInvited):
+		return "not_invited"
+	case errors.Is(err, services.ErrEmailInUse):
+		return "email_in_use"
+	case errors.Is(err, services.ErrIdentityInUse):
+		return "identity_in_use"
+	case errors.Is(err, services.ErrEmailNotVerified):
+		return "email_not_verified"
+	case errors.Is(err, services.ErrVerificationRequired):
+		return "verification_required"
+	default:
+		return ""
+	}
+}
+
+// sanitizeRedirect only allows same-origin paths as post-login redirect targets
+func sanitizeRedirect(redirect string) string {
+	if !strings.HasPrefix(redirect, "/") || strings.HasPrefix(redirect, "//") || strings.HasPrefix(redirect, "/\\") {
+		return "/"
+	}
+
+	parsed, err := url.Parse(redirect)
+	if err != nil || parsed.Scheme != "" || parsed.Host != "" {
+		return "/"
+	}
+
+	return redirect
+}
+
+// deviceInfo extracts the client device details from the request
+func deviceInfo(ctx *gin.Context) *models.DeviceInfo {
+	return &models.DeviceInfo{
+		DeviceID:  ctx.GetHeader("X-Device-ID"),
+		UserAgent: ctx.Request.UserAgent(),
+		IPAddress: ctx.ClientIP(),
+	}
+}
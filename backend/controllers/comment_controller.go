@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// CommentController handles endpoints for comments on posts
+type CommentController struct {
+	commentService *services.CommentService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+}
+
+// NewCommentController creates a new CommentController
+func NewCommentController(commentService *services.CommentService, authMiddleware *middleware.AuthMiddleware) *CommentController {
+	return &CommentController{
+		commentService: commentService,
+		authMiddleware: authMiddleware,
+		logger:         utils.GetLogger(),
+	}
+}
+
+// commentRequest is the request body for creating or editing a comment
+type commentRequest struct {
+	Content string `json:"content" binding:"required,max=2000"`
+}
+
+// RegisterRoutes registers the routes for the CommentController
+func (c *CommentController) RegisterRoutes(router *gin.Engine) {
+	comments := router.Group("/posts/:id/comments")
+	{
+		// Comments on public posts are readable without logging in
+		comments.GET("", c.authMiddleware.OptionalAuth(), c.authMiddleware.RequireScope(models.ScopePostsRead), c.ListComments)
+		comments.POST("", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireScope(models.ScopePostsWrite), c.CreateComment)
+		comments.PUT("/:commentId", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireScope(models.ScopePostsWrite), c.UpdateComment)
+		comments.DELETE("/:commentId", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireScope(models.ScopePostsWrite), c.DeleteComment)
+	}
+}
+
+// ListComments returns a page of the comments on a post
+func (c *CommentController) ListComments(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware, empty for anonymous visitors)
+	userID := ctx.GetString("user_id")
+
+	// Parse pagination parameters
+	page, err := parsePageRequest(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comments, err := c.commentService.ListComments(ctx.Param("id"), userID, page)
+	if err != nil {
+		respondWithCommentError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, comments)
+}
+
+// CreateComment adds a comment to a post
+func (c *CommentController) CreateComment(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Parse request body
+	var req commentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment, err := c.commentService.CreateComment(ctx.Param("id"), userID, req.Content)
+	if err != nil {
+		respondWithCommentError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"comment": comment})
+}
+
+// UpdateComment edits a comment of the authenticated user
+func (c *CommentController) UpdateComment(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Parse request body
+	var req commentRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment, err := c.commentService.UpdateComment(ctx.Param("id"), ctx.Param("commentId"), userID, req.Content)
+	if err != nil {
+		respondWithCommentError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"comment": comment})
+}
+
+// DeleteComment deletes a comment. Comment authors, post owners and moderators may delete comments.
+func (c *CommentController) DeleteComment(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+	canModerate := middleware.HasPermission(ctx, models.PermissionModerateContent)
+
+	err := c.commentService.DeleteComment(ctx.Param("id"), ctx.Param("commentId"), userID, canModerate)
+	if err != nil {
+		respondWithCommentError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
+}
+
+// respondWithCommentError maps an error from the CommentService to its response
+func respondWithCommentError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPostNotFound), errors.Is(err, services.ErrCommentNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCommentForbidden):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, utils.ErrInvalidCursor):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// LocalAuthController handles username/password authentication endpoints
+type LocalAuthController struct {
+	localAuthService *services.LocalAuthService
+	authService      *services.AuthService
+	authController   *AuthController
+	rateLimiter      *middleware.RateLimiter
+	logger           *logrus.Logger
+}
+
+// NewLocalAuthController creates a new LocalAuthController. Logins are completed through
+// the AuthController, so local users go through the same two-factor challenge.
+func NewLocalAuthController(localAuthService *services.LocalAuthService, authService *services.AuthService, authController *AuthController, rateLimiter *middleware.RateLimiter) *LocalAuthController {
+	return &LocalAuthController{
+		localAuthService: localAuthService,
+		authService:      authService,
+		authController:   authController,
+		rateLimiter:      rateLimiter,
+		logger:           utils.GetLogger(),
+	}
+}
+
+// registerRequest is the request body for the registration endpoint
+type registerRequest struct {
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Username string `json:"username" binding:"required,min=3,max=50"`
+	Password string `json:"password" binding:"required,min=8,max=128"`
+}
+
+// localLoginRequest is the request body for the local login endpoint
+type localLoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// passwordResetRequest is the request body for the password reset request endpoint
+type passwordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// verifyEmailRequest is the request body for the email verification endpoint
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// passwordResetConfirmRequest is the request body for the password reset confirmation endpoint
+type passwordResetConfirmRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=128"`
+}
+
+// RegisterRoutes registers the routes for the LocalAuthController
+func (c *LocalAuthController) RegisterRoutes(router *gin.Engine) {
+	local := router.Group("/auth/local")
+	local.Use(c.rateLimiter.ByIP("local"))
+	{
+		local.POST("/register", c.Register)
+		local.POST("/login", c.Login)
+		local.POST("/verify-email", c.VerifyEmail)
+		local.POST("/verify-email/resend", c.ResendVerification)
+		local.POST("/password-reset", c.RequestPasswordReset)
+		local.POST("/password-reset/confirm", c.ConfirmPasswordReset)
+	}
+}
+
+// Register creates a local user and emails them a verification link. No tokens are issued
+// until the address is verified.
+func (c *LocalAuthController) Register(ctx *gin.Context) {
+	// Parse request body
+	var req registerRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Create user
+	_, err := c.localAuthService.Register(req.Email, req.Username, req.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrUserExists) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if code := signInErrorCode(err); code != "" {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": code})
+			return
+		}
+		c.logger.WithError(err).Error("Failed to register user")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "Check your email to verify your address"})
+}
+
+// VerifyEmail verifies a local user's email with a verification token and signs them in
+func (c *LocalAuthController) VerifyEmail(ctx *gin.Context) {
+	// Parse request body
+	var req verifyEmailRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := c.localAuthService.VerifyEmail(req.Token)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if code := signInErrorCode(err); code != "" {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": code})
+			return
+		}
+		c.logger.WithError(err).Error("Failed to verify email")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.authController.signIn(ctx, user, []string{models.AuthMethodPassword})
+}
+
+// ResendVerification emails a new verification link. It always reports success.
+func (c *LocalAuthController) ResendVerification(ctx *gin.Context) {
+	// Parse request body
+	var req passwordResetRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.localAuthService.ResendVerification(req.Email); err != nil {
+		c.logger.WithError(err).Error("Failed to resend verification email")
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "If the account needs verification, an email has been sent"})
+}
+
+// Login signs in a local user with their email and password
+func (c *LocalAuthController) Login(ctx *gin.Context) {
+	// Parse request body
+	var req localLoginRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Check credentials
+	user, err := c.localAuthService.Authenticate(req.Email, req.Password)
+	if err != nil {
+		if respondIfThrottled(ctx, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if code := signInErrorCode(err); code != "" {
+			ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": code})
+			return
+		}
+		c.logger.WithError(err).Error("Failed to authenticate user")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication"})
+		return
+	}
+
+	c.authController.signIn(ctx, user, []string{models.AuthMethodPassword})
+}
+
+// RequestPasswordReset emails a password reset link. It always reports success.
+func (c *LocalAuthController) RequestPasswordReset(ctx *gin.Context) {
+	// Parse request body
+	var req passwordResetRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.localAuthService.RequestPasswordReset(req.Email); err != nil {
+		c.logger.WithError(err).Error("Failed to request password reset")
+	}
+
+	ctx.JSON(http.StatusAccepted, gin.H{"message": "If the account exists, a password reset email has been sent"})
+}
+
+// ConfirmPasswordReset sets a new password using a password reset token
+func (c *LocalAuthController) ConfirmPasswordReset(ctx *gin.Context) {
+	// Parse request body
+	var req passwordResetConfirmRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := c.localAuthService.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, services.ErrInvalidResetToken) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.WithError(err).Error("Failed to reset password")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
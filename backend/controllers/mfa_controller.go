@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go-azure/config"
+	"go-azure/middleware"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// MFAController handles two-factor authentication endpoints
+type MFAController struct {
+	mfaService     *services.MFAService
+	authMiddleware *middleware.AuthMiddleware
+	sessionCookies *middleware.SessionCookies
+	rateLimiter    *middleware.RateLimiter
+	logger         *logrus.Logger
+	config         *config.Config
+}
+
+// NewMFAController creates a new MFAController
+func NewMFAController(mfaService *services.MFAService, authMiddleware *middleware.AuthMiddleware, sessionCookies *middleware.SessionCookies, rateLimiter *middleware.RateLimiter, config *config.Config) *MFAController {
+	return &MFAController{
+		mfaService:     mfaService,
+		authMiddleware: authMiddleware,
+		sessionCookies: sessionCookies,
+		rateLimiter:    rateLimiter,
+		logger:         utils.GetLogger(),
+		config:         config,
+	}
+}
+
+// mfaCodeRequest is the request body for endpoints that take a TOTP or recovery code
+type mfaCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// mfaChallengeRequest is the request body for the MFA challenge endpoint
+type mfaChallengeRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// RegisterRoutes registers the routes for the MFAController
+func (c *MFAController) RegisterRoutes(router *gin.Engine) {
+	requireRecentMFA := c.authMiddleware.RequireRecentMFA(time.Duration(c.config.MFAMaxAgeMinutes) * time.Minute)
+
+	mfa := router.Group("/auth/mfa")
+	{
+		mfa.POST("/challenge", c.rateLimiter.ByIP("token"), c.CompleteChallenge)
+
+		authenticated := mfa.Group("")
+		authenticated.Use(c.authMiddleware.RequireAuth(), c.authMiddleware.RequireInteractiveAuth())
+		{
+			authenticated.POST("/totp/enroll", c.Enroll)
+			authenticated.POST("/totp/confirm", c.ConfirmEnrollment)
+			authenticated.DELETE("/totp", requireRecentMFA, c.Disable)
+			authenticated.POST("/recovery-codes", requireRecentMFA, c.RegenerateRecoveryCodes)
+			authenticated.POST("/step-up", c.StepUp)
+		}
+	}
+}
+
+// CompleteChallenge verifies the second factor of a login and returns its tokens
+func (c *MFAController) CompleteChallenge(ctx *gin.Context) {
+	// Parse request body
+	var req mfaChallengeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokenDetails, user, err := c.mfaService.CompleteChallenge(req.MFAToken, req.Code, deviceInfo(ctx))
+	if err != nil {
+		if respondIfThrottled(ctx, err) {
+			return
+		}
+		if errors.Is(err, services.ErrInvalidMFAChallenge) || errors.Is(err, services.ErrInvalidMFACode) {
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.WithError(err).Error("Failed to complete MFA challenge")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication"})
+		return
+	}
+
+	respondWithTokens(ctx, c.sessionCookies, http.StatusOK, tokenDetails, user)
+}
+
+// Enroll starts TOTP enrollment and returns the secret and its provisioning URI
+func (c *MFAController) Enroll(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	enrollment, err := c.mfaService.Enroll(userID)
+	if err != nil {
+		if errors.Is(err, services.ErrMFAAlreadyEnabled) {
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmEnrollment enables TOTP and returns the recovery codes, which are shown only once
+func (c *MFAController) ConfirmEnrollment(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Parse request body
+	var req mfaCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := c.mfaService.ConfirmEnrollment(userID, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMFAAlreadyEnabled):
+			ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrMFANotEnrolled), errors.Is(err, services.ErrInvalidMFACode):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Disable turns off TOTP for the authenticated user
+func (c *MFAController) Disable(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	if err := c.mfaService.Disable(userID); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the authenticated user
+func (c *MFAController) RegenerateRecoveryCodes(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	codes, err := c.mfaService.RegenerateRecoveryCodes(userID)
+	if err != nil {
+		if errors.Is(err, services.ErrMFANotEnabled) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// StepUp verifies a second factor for the current session and returns new tokens
+// that satisfy routes requiring a recent MFA
+func (c *MFAController) StepUp(ctx *gin.Context) {
+	// Get user and session IDs from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+	sessionID := ctx.GetString("session_id")
+
+	// Parse request body
+	var req mfaCodeRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokenDetails, err := c.mfaService.StepUp(userID, sessionID, req.Code)
+	if err != nil {
+		if respondIfThrottled(ctx, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, services.ErrMFANotEnabled):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrInvalidMFACode):
+			c.logger.WithField("user_id", userID).Warn("Invalid MFA code for step-up")
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrSessionNotFound):
+			ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	respondWithTokens(ctx, c.sessionCookies, http.StatusOK, tokenDetails, nil)
+}
@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+
+	"go-azure/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errInvalidLimit is returned when the limit query parameter is not a positive integer
+var errInvalidLimit = errors.New("limit must be a positive integer")
+
+// parsePageRequest reads the cursor and limit query parameters of a paginated listing.
+// Limits above services.MaxPageSize are capped.
+func parsePageRequest(ctx *gin.Context) (services.PageRequest, error) {
+	page := services.PageRequest{
+		Cursor: ctx.Query("cursor"),
+		Limit:  services.DefaultPageSize,
+	}
+
+	if raw := ctx.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 {
+			return page, errInvalidLimit
+		}
+		page.Limit = min(limit, services.MaxPageSize)
+	}
+
+	return page, nil
+}
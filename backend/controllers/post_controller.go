@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 
 	"go-azure/middleware"
@@ -28,33 +29,96 @@ func NewPostController(postService *services.PostService, authMiddleware *middle
 	}
 }
 
+// postRequest is the request body for creating or updating a post. Only the fields a
+// user may set are bound, so timestamps, IDs and counters cannot be forged.
+type postRequest struct {
+	Content    string            `json:"content" binding:"required"`
+	Caption    string            `json:"caption"`
+	Visibility models.Visibility `json:"visibility"`
+	GroupID    string            `json:"group_id"`
+}
+
+// toPost returns the post described by the request
+func (r postRequest) toPost() models.Post {
+	return models.Post{
+		Content:    r.Content,
+		Caption:    r.Caption,
+		Visibility: r.Visibility,
+		GroupID:    r.GroupID,
+	}
+}
+
 // RegisterRoutes registers the routes for the PostController
 func (c *PostController) RegisterRoutes(router *gin.Engine) {
+	// The feed merges the public posts of all users
+	router.GET("/feed", c.authMiddleware.OptionalAuth(), c.authMiddleware.RequireScope(models.ScopePostsRead), c.GetFeed)
+
 	posts := router.Group("/posts")
-	posts.Use(c.authMiddleware.RequireAuth())
 	{
-		posts.GET("", c.GetAllPosts)
-		posts.GET("/:id", c.GetPostByID)
-		posts.POST("", c.CreatePost)
-		posts.PUT("/:id", c.UpdatePost)
-		posts.DELETE("/:id", c.DeletePost)
+		// Public posts are readable without logging in
+		posts.GET("", c.authMiddleware.OptionalAuth(), c.authMiddleware.RequireScope(models.ScopePostsRead), c.GetAllPosts)
+		posts.GET("/:id", c.authMiddleware.OptionalAuth(), c.authMiddleware.RequireScope(models.ScopePostsRead), c.GetPostByID)
+		posts.POST("", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireScope(models.ScopePostsWrite), c.CreatePost)
+		posts.PUT("/:id", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireScope(models.ScopePostsWrite), c.UpdatePost)
+		posts.DELETE("/:id", c.authMiddleware.RequireAuth(), c.authMiddleware.RequireScope(models.ScopePostsWrite), c.DeletePost)
 	}
 }
 
-// GetAllPosts returns all posts for the authenticated user
+// GetAllPosts returns a page of the posts of the authenticated user, or of the public posts for anonymous visitors
 func (c *PostController) GetAllPosts(ctx *gin.Context) {
-	// Get user ID from context (set by auth middleware)
+	// Get user ID from context (set by auth middleware, empty for anonymous visitors)
 	userID := ctx.GetString("user_id")
 
+	// Parse pagination parameters
+	page, err := parsePageRequest(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Get posts
-	posts := c.postService.GetAllPosts(userID)
+	posts, err := c.postService.GetAllPosts(userID, page)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidCursor) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, posts)
+}
+
+// GetFeed returns a page of the public posts of all users, leaving out users the viewer has blocked
+func (c *PostController) GetFeed(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware, empty for anonymous visitors)
+	viewerID := ctx.GetString("user_id")
+
+	// Parse pagination parameters
+	page, err := parsePageRequest(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get feed
+	feed, err := c.postService.GetFeed(viewerID, page)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidCursor) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
-	ctx.JSON(http.StatusOK, gin.H{"posts": posts})
+	ctx.JSON(http.StatusOK, feed)
 }
 
 // GetPostByID returns a post by ID
 func (c *PostController) GetPostByID(ctx *gin.Context) {
-	// Get user ID from context (set by auth middleware)
+	// Get user ID from context (set by auth middleware, empty for anonymous visitors)
 	userID := ctx.GetString("user_id")
 
 	// Get post ID from URL
@@ -63,8 +127,11 @@ func (c *PostController) GetPostByID(ctx *gin.Context) {
 	// Get post
 	post, err := c.postService.GetPostByID(postID, userID)
 	if err != nil {
-		c.logger.WithError(err).Error("Failed to get post")
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		if errors.Is(err, services.ErrPostNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -77,18 +144,18 @@ func (c *PostController) CreatePost(ctx *gin.Context) {
 	userID := ctx.GetString("user_id")
 
 	// Parse request body
-	var post models.Post
-	if err := ctx.ShouldBindJSON(&post); err != nil {
+	var req postRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		c.logger.WithError(err).Error("Failed to parse request body")
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	post := req.toPost()
 
 	// Create post
 	createdPost, err := c.postService.CreatePost(&post, userID)
 	if err != nil {
-		c.logger.WithError(err).Error("Failed to create post")
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithPostError(ctx, err)
 		return
 	}
 
@@ -104,18 +171,18 @@ func (c *PostController) UpdatePost(ctx *gin.Context) {
 	postID := ctx.Param("id")
 
 	// Parse request body
-	var post models.Post
-	if err := ctx.ShouldBindJSON(&post); err != nil {
+	var req postRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
 		c.logger.WithError(err).Error("Failed to parse request body")
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	post := req.toPost()
 
 	// Update post
 	updatedPost, err := c.postService.UpdatePost(postID, &post, userID)
 	if err != nil {
-		c.logger.WithError(err).Error("Failed to update post")
-		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		respondWithPostError(ctx, err)
 		return
 	}
 
@@ -140,3 +207,17 @@ func (c *PostController) DeletePost(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
+
+// respondWithPostError maps an error from creating or updating a post to its response
+func respondWithPostError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPostNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidVisibility):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrNotGroupMember):
+		ctx.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ReactionController handles endpoints for reactions to posts
+type ReactionController struct {
+	reactionService *services.ReactionService
+	authMiddleware  *middleware.AuthMiddleware
+	logger          *logrus.Logger
+}
+
+// NewReactionController creates a new ReactionController
+func NewReactionController(reactionService *services.ReactionService, authMiddleware *middleware.AuthMiddleware) *ReactionController {
+	return &ReactionController{
+		reactionService: reactionService,
+		authMiddleware:  authMiddleware,
+		logger:          utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the ReactionController. Both routes are
+// idempotent, so clients can safely retry them.
+func (c *ReactionController) RegisterRoutes(router *gin.Engine) {
+	reactions := router.Group("/posts/:id/reactions")
+	reactions.Use(c.authMiddleware.RequireAuth(), c.authMiddleware.RequireScope(models.ScopePostsWrite))
+	{
+		reactions.PUT("/:kind", c.AddReaction)
+		reactions.DELETE("/:kind", c.RemoveReaction)
+	}
+}
+
+// AddReaction reacts to a post on behalf of the authenticated user
+func (c *ReactionController) AddReaction(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	post, err := c.reactionService.AddReaction(ctx.Param("id"), userID, models.ReactionKind(ctx.Param("kind")))
+	if err != nil {
+		respondWithReactionError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"post": post})
+}
+
+// RemoveReaction takes back a reaction of the authenticated user
+func (c *ReactionController) RemoveReaction(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	post, err := c.reactionService.RemoveReaction(ctx.Param("id"), userID, models.ReactionKind(ctx.Param("kind")))
+	if err != nil {
+		respondWithReactionError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"post": post})
+}
+
+// respondWithReactionError maps an error from the ReactionService to its response
+func respondWithReactionError(ctx *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidReaction):
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPostNotFound):
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
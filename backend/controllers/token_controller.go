@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-azure/middleware"
+	"go-azure/models"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// TokenController handles personal access token endpoints
+type TokenController struct {
+	tokenService   *services.TokenService
+	userService    *services.UserService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+}
+
+// NewTokenController creates a new TokenController
+func NewTokenController(tokenService *services.TokenService, userService *services.UserService, authMiddleware *middleware.AuthMiddleware) *TokenController {
+	return &TokenController{
+		tokenService:   tokenService,
+		userService:    userService,
+		authMiddleware: authMiddleware,
+		logger:         utils.GetLogger(),
+	}
+}
+
+// createTokenRequest is the request body for the token creation endpoint
+type createTokenRequest struct {
+	Name          string         `json:"name" binding:"required,max=100"`
+	Scopes        []models.Scope `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int            `json:"expires_in_days" binding:"min=0,max=365"`
+}
+
+// RegisterRoutes registers the routes for the TokenController
+func (c *TokenController) RegisterRoutes(router *gin.Engine) {
+	tokens := router.Group("/auth/tokens")
+	tokens.Use(c.authMiddleware.RequireAuth(), c.authMiddleware.RequireInteractiveAuth())
+	{
+		tokens.GET("", c.ListTokens)
+		tokens.POST("", c.CreateToken)
+		tokens.DELETE("/:id", c.DeleteToken)
+	}
+}
+
+// ListTokens returns the personal access tokens of the authenticated user
+func (c *TokenController) ListTokens(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get tokens
+	tokens := c.tokenService.ListTokens(userID)
+
+	ctx.JSON(http.StatusOK, gin.H{"tokens": tokens})
+}
+
+// CreateToken creates a new personal access token. The raw token is only returned once.
+func (c *TokenController) CreateToken(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Parse request body
+	var req createTokenRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		c.logger.WithError(err).Error("Failed to parse request body")
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get user to check which scopes they may grant
+	user, err := c.userService.GetUserByID(userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Create token
+	token, rawToken, err := c.tokenService.CreateToken(user, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidScope) {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.logger.WithError(err).Error("Failed to create token")
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{"token": token, "access_token": rawToken})
+}
+
+// DeleteToken deletes a personal access token
+func (c *TokenController) DeleteToken(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	// Get token ID from URL
+	tokenID := ctx.Param("id")
+
+	// Delete token
+	err := c.tokenService.DeleteToken(tokenID, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrTokenNotFound) {
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Token deleted successfully"})
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"go-azure/middleware"
+	"go-azure/services"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// UserController handles endpoints for managing relationships with other users
+type UserController struct {
+	userService    *services.UserService
+	authMiddleware *middleware.AuthMiddleware
+	logger         *logrus.Logger
+}
+
+// NewUserController creates a new UserController
+func NewUserController(userService *services.UserService, authMiddleware *middleware.AuthMiddleware) *UserController {
+	return &UserController{
+		userService:    userService,
+		authMiddleware: authMiddleware,
+		logger:         utils.GetLogger(),
+	}
+}
+
+// RegisterRoutes registers the routes for the UserController
+func (c *UserController) RegisterRoutes(router *gin.Engine) {
+	users := router.Group("/users")
+	users.Use(c.authMiddleware.RequireAuth(), c.authMiddleware.RequireInteractiveAuth())
+	{
+		users.GET("/blocks", c.ListBlockedUsers)
+		users.POST("/:id/block", c.BlockUser)
+		users.DELETE("/:id/block", c.UnblockUser)
+	}
+}
+
+// ListBlockedUsers returns the users the authenticated user has blocked
+func (c *UserController) ListBlockedUsers(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	users, err := c.userService.ListBlockedUsers(userID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// BlockUser blocks a user for the authenticated user
+func (c *UserController) BlockUser(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	err := c.userService.BlockUser(userID, ctx.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrCannotBlockSelf):
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrUserNotFound):
+			ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "User blocked"})
+}
+
+// UnblockUser removes a block of the authenticated user
+func (c *UserController) UnblockUser(ctx *gin.Context) {
+	// Get user ID from context (set by auth middleware)
+	userID := ctx.GetString("user_id")
+
+	if err := c.userService.UnblockUser(userID, ctx.Param("id")); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "User unblocked"})
+}
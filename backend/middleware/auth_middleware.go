@@ -1,79 +1,296 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"go-azure/models"
 	"go-azure/services"
 	"go-azure/utils"
 )
 
-// AuthMiddleware is a middleware for JWT authentication
+// AuthMiddleware is a middleware for JWT and personal access token authentication.
+// In cookie auth mode the JWT may also come from the access token cookie.
 type AuthMiddleware struct {
-	authService *services.AuthService
-	logger      *logrus.Logger
+	authService    *services.AuthService
+	tokenService   *services.TokenService
+	sessionCookies *SessionCookies
+	logger         *logrus.Logger
 }
 
 // NewAuthMiddleware creates a new AuthMiddleware
-func NewAuthMiddleware(authService *services.AuthService) *AuthMiddleware {
+func NewAuthMiddleware(authService *services.AuthService, tokenService *services.TokenService, sessionCookies *SessionCookies) *AuthMiddleware {
 	return &AuthMiddleware{
-		authService: authService,
-		logger:      utils.GetLogger(),
+		authService:    authService,
+		tokenService:   tokenService,
+		sessionCookies: sessionCookies,
+		logger:         utils.GetLogger(),
 	}
 }
 
-// RequireAuth is a middleware that requires JWT authentication
+var (
+	// errMissingAuthHeader is returned when the request has no authorization header
+	errMissingAuthHeader = errors.New("authorization header is required")
+	// errInvalidAuthHeader is returned when the authorization header is not a bearer token
+	errInvalidAuthHeader = errors.New("invalid authorization header format")
+)
+
+// RequireAuth is a middleware that requires a JWT or a personal access token
 func (m *AuthMiddleware) RequireAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get authorization header
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			m.logger.Warn("Missing authorization header")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "authorization header is required"})
+		if err := m.authenticate(c); err != nil {
+			switch {
+			case errors.Is(err, errMissingAuthHeader):
+				m.logger.Warn("Missing authorization header")
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			case errors.Is(err, errInvalidAuthHeader):
+				m.logger.Warn("Invalid authorization header format")
+				c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			default:
+				m.logger.WithError(err).Warn("Invalid token")
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			}
 			c.Abort()
 			return
 		}
 
-		// Check if the header has the Bearer prefix
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			m.logger.Warn("Invalid authorization header format")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid authorization header format"})
-			c.Abort()
+		m.logger.WithFields(logrus.Fields{
+			"user_id":     c.GetString("user_id"),
+			"auth_method": c.GetString("auth_method"),
+		}).Info("User authenticated")
+
+		c.Next()
+	}
+}
+
+// OptionalAuth is a middleware that authenticates the request when it carries a valid
+// JWT or personal access token, and otherwise continues anonymously without a user_id
+func (m *AuthMiddleware) OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := m.authenticate(c); err != nil {
+			if !errors.Is(err, errMissingAuthHeader) {
+				m.logger.WithError(err).Warn("Ignoring invalid credentials on optionally authenticated request")
+			}
+			c.Next()
 			return
 		}
 
-		// Extract token
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		m.logger.WithFields(logrus.Fields{
+			"user_id":     c.GetString("user_id"),
+			"auth_method": c.GetString("auth_method"),
+		}).Info("User authenticated")
+
+		c.Next()
+	}
+}
+
+// authenticate validates the bearer token of the request, or in cookie auth mode the access
+// token cookie, and sets the user info in the context
+func (m *AuthMiddleware) authenticate(c *gin.Context) error {
+	// Get authorization header
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" {
+		// CSRF protection for cookie requests is enforced by SessionCookies.RequireCSRF
+		if m.sessionCookies.Enabled() {
+			if tokenString, err := c.Cookie(AccessTokenCookie); err == nil && tokenString != "" {
+				return m.authenticateJWT(c, tokenString)
+			}
+		}
+		return errMissingAuthHeader
+	}
+
+	// Check if the header has the Bearer prefix
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return errInvalidAuthHeader
+	}
+
+	// Extract token
+	tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+
+	// Validate token
+	if strings.HasPrefix(tokenString, services.PersonalAccessTokenPrefix) {
+		return m.authenticateAccessToken(c, tokenString)
+	}
+	return m.authenticateJWT(c, tokenString)
+}
+
+// authenticateJWT validates a JWT and sets the user info from its claims in the context
+func (m *AuthMiddleware) authenticateJWT(c *gin.Context, tokenString string) error {
+	claims, err := m.authService.ValidateToken(tokenString)
+	if err != nil {
+		return err
+	}
+
+	userID, ok := claims["user_id"].(string)
+	if !ok || userID == "" {
+		return errors.New("user ID not found in token")
+	}
+
+	// Set user info in context
+	c.Set("auth_method", "jwt")
+	c.Set("user_id", userID)
+	c.Set("email", claims["email"])
+	c.Set("name", claims["name"])
+	c.Set("role", models.Role(claims["role"].(string)))
+	c.Set("scopes", models.ParseScopes(claims["scope"].(string)))
+	c.Set("jti", claims["jti"])
+	c.Set("session_id", claims["sid"])
+	c.Set("amr", claims["amr"])
+	if authTime, ok := claims["auth_time"].(int64); ok {
+		c.Set("auth_time", time.Unix(authTime, 0))
+	}
+
+	// Record session activity for the session listing
+	if sessionID, _ := claims["sid"].(string); sessionID != "" {
+		m.authService.TouchSession(sessionID)
+	}
+
+	return nil
+}
+
+// authenticateAccessToken validates a personal access token and sets its owner and scopes in the context
+func (m *AuthMiddleware) authenticateAccessToken(c *gin.Context, tokenString string) error {
+	token, user, err := m.tokenService.ValidateToken(tokenString)
+	if err != nil {
+		return err
+	}
+
+	// Set user info in context
+	c.Set("auth_method", "pat")
+	c.Set("user_id", user.ID)
+	c.Set("email", user.Email)
+	c.Set("name", user.Name)
+	c.Set("role", user.Role)
+	c.Set("token_id", token.ID)
+	c.Set("scopes", token.Scopes)
 
-		// Validate token
-		claims, err := m.authService.ValidateToken(tokenString)
-		if err != nil {
-			m.logger.WithError(err).Warn("Invalid token")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+	return nil
+}
+
+// RequireInteractiveAuth is a middleware that rejects personal access tokens, so a leaked token
+// cannot be used to manage tokens, sessions or sign-in methods. It must be used after RequireAuth.
+func (m *AuthMiddleware) RequireInteractiveAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") == "pat" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "personal access tokens cannot be used for this endpoint"})
 			c.Abort()
 			return
 		}
 
-		// Set user ID in context
-		userID, ok := claims["user_id"].(string)
-		if !ok {
-			m.logger.Warn("User ID not found in token")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		c.Next()
+	}
+}
+
+// RequireRecentMFA is a middleware that requires the user to have completed a second factor
+// within maxAge, as shown by the amr and auth_time claims of their JWT. Personal access tokens
+// never satisfy it. The WWW-Authenticate challenge follows RFC 9470, so clients know to step up.
+// It must be used after RequireAuth.
+func (m *AuthMiddleware) RequireRecentMFA(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		amr, _ := c.Get("amr")
+		methods, _ := amr.([]string)
+		authTime := c.GetTime("auth_time")
+
+		if !slices.Contains(methods, models.AuthMethodMFA) || time.Since(authTime) > maxAge {
+			m.logger.WithFields(logrus.Fields{
+				"user_id":     c.GetString("user_id"),
+				"auth_method": c.GetString("auth_method"),
+			}).Warn("Recent multi-factor authentication required")
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", max_age=%d`, int(maxAge.Seconds())))
+			c.JSON(http.StatusForbidden, gin.H{"error": "recent multi-factor authentication required", "code": "mfa_required"})
 			c.Abort()
 			return
 		}
 
-		// Set user info in context
-		c.Set("user_id", userID)
-		c.Set("email", claims["email"])
-		c.Set("name", claims["name"])
+		c.Next()
+	}
+}
+
+// RequireRole is a middleware that requires the authenticated user to have one of the given roles.
+// It must be used after RequireAuth.
+func (m *AuthMiddleware) RequireRole(roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := userRole(c)
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
 
 		m.logger.WithFields(logrus.Fields{
-			"user_id": userID,
-		}).Info("User authenticated")
+			"user_id": c.GetString("user_id"),
+			"role":    role,
+		}).Warn("Insufficient role")
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient role"})
+		c.Abort()
+	}
+}
+
+// RequirePermission is a middleware that requires the authenticated user's role to grant
+// all of the given permissions. It must be used after RequireAuth.
+func (m *AuthMiddleware) RequirePermission(permissions ...models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := userRole(c)
+		for _, permission := range permissions {
+			if !role.HasPermission(permission) {
+				m.logger.WithFields(logrus.Fields{
+					"user_id":    c.GetString("user_id"),
+					"role":       role,
+					"permission": permission,
+				}).Warn("Insufficient permissions")
+				c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+				c.Abort()
+				return
+			}
+		}
 
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// RequireScope is a middleware that requires the token to carry the given scope.
+// It must be used after RequireAuth or OptionalAuth; anonymous requests let through
+// by OptionalAuth carry no token and are not checked.
+func (m *AuthMiddleware) RequireScope(scope models.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_method") == "" {
+			c.Next()
+			return
+		}
+
+		scopes, _ := c.Get("scopes")
+		granted, _ := scopes.([]models.Scope)
+		if !models.HasScope(granted, scope) {
+			m.logger.WithFields(logrus.Fields{
+				"user_id": c.GetString("user_id"),
+				"scope":   scope,
+			}).Warn("Insufficient scope")
+			c.Header("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			c.JSON(http.StatusForbidden, gin.H{"error": "insufficient scope", "missing_scope": scope})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// HasPermission reports whether the authenticated user's role grants the permission,
+// for handlers that allow more to privileged users than to everyone else
+func HasPermission(c *gin.Context, permission models.Permission) bool {
+	return userRole(c).HasPermission(permission)
+}
+
+// userRole returns the role set in the context by RequireAuth
+func userRole(c *gin.Context) models.Role {
+	role, _ := c.Get("role")
+	r, _ := role.(models.Role)
+	return r
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-azure/config"
+	"go-azure/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newRateLimitedRouter(limitPerMinute int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	limiter := NewRateLimiter(services.NewMemoryRateLimitStore(), &config.Config{AuthRateLimitPerMinute: limitPerMinute})
+	router := gin.New()
+	router.GET("/a", limiter.ByIP("auth"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/b", limiter.ByIP("auth"), func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func request(router *gin.Engine, path string, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = ip + ":12345"
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder
+}
+
+func TestRateLimiterByIP(t *testing.T) {
+	router := newRateLimitedRouter(2)
+
+	// Routes sharing a name share the budget
+	for _, path := range []string{"/a", "/b"} {
+		if recorder := request(router, path, "192.0.2.1"); recorder.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d, want 200", path, recorder.Code)
+		}
+	}
+
+	recorder := request(router, "/a", "192.0.2.1")
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want 429", recorder.Code)
+	}
+	if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != "30" {
+		t.Errorf("got Retry-After %q, want 30", retryAfter)
+	}
+
+	// Other clients have their own budget
+	if recorder := request(router, "/a", "192.0.2.2"); recorder.Code != http.StatusOK {
+		t.Fatalf("other IP: got status %d, want 200", recorder.Code)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	router := newRateLimitedRouter(0)
+
+	for i := 0; i < 50; i++ {
+		if recorder := request(router, "/a", "192.0.2.1"); recorder.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d, want 200", i+1, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Cookie and header names used in cookie auth mode
+const (
+	// AccessTokenCookie holds the JWT. It is HttpOnly so scripts cannot read it.
+	AccessTokenCookie = "access_token"
+	// RefreshTokenCookie holds the refresh token and is only sent to the /auth routes
+	RefreshTokenCookie = "refresh_token"
+	// CSRFTokenCookie holds the double-submit CSRF token. Scripts read it and echo it in CSRFHeader.
+	CSRFTokenCookie = "csrf_token"
+	// CSRFHeader is the header state-changing requests must repeat the CSRF token in
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// refreshTokenCookiePath limits the refresh token cookie to the routes that use it
+const refreshTokenCookiePath = "/auth"
+
+// SessionCookies issues and clears the session cookies used when AUTH_MODE is "cookie"
+type SessionCookies struct {
+	config   *config.Config
+	logger   *logrus.Logger
+	sameSite http.SameSite
+}
+
+// NewSessionCookies creates a new SessionCookies
+func NewSessionCookies(config *config.Config) *SessionCookies {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(config.CookieSameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return &SessionCookies{
+		config:   config,
+		logger:   utils.GetLogger(),
+		sameSite: sameSite,
+	}
+}
+
+// Enabled reports whether cookie auth mode is selected
+func (s *SessionCookies) Enabled() bool {
+	return s.config.AuthMode == "cookie"
+}
+
+// Set stores the tokens in HttpOnly cookies together with a new CSRF token, and returns the
+// CSRF token so it can also be handed to the client in the response body
+func (s *SessionCookies) Set(c *gin.Context, tokenDetails *models.TokenDetails) (string, error) {
+	csrfToken, err := generateCSRFToken()
+	if err != nil {
+		return "", err
+	}
+
+	refreshMaxAge := s.config.RefreshTokenTTLDays * 24 * 60 * 60
+
+	s.setCookie(c, AccessTokenCookie, tokenDetails.AccessToken, "/", int(time.Until(tokenDetails.ExpiresAt).Seconds()), true)
+	s.setCookie(c, RefreshTokenCookie, tokenDetails.RefreshToken, refreshTokenCookiePath, refreshMaxAge, true)
+	s.setCookie(c, CSRFTokenCookie, csrfToken, "/", refreshMaxAge, false)
+
+	return csrfToken, nil
+}
+
+// Clear removes the session cookies
+func (s *SessionCookies) Clear(c *gin.Context) {
+	s.setCookie(c, AccessTokenCookie, "", "/", -1, true)
+	s.setCookie(c, RefreshTokenCookie, "", refreshTokenCookiePath, -1, true)
+	s.setCookie(c, CSRFTokenCookie, "", "/", -1, false)
+}
+
+// setCookie sets a cookie with the configured domain, Secure flag and SameSite mode
+func (s *SessionCookies) setCookie(c *gin.Context, name string, value string, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   s.config.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   s.config.CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: s.sameSite,
+	})
+}
+
+// RequireCSRF is a middleware that enforces double-submit CSRF protection in cookie auth mode.
+// State-changing requests that carry session cookies and no Authorization header must repeat
+// the CSRF cookie in the X-CSRF-Token header. Requests authenticated with a bearer token are
+// not vulnerable to CSRF and are let through.
+func (s *SessionCookies) RequireCSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !s.Enabled() || !isStateChanging(c.Request.Method) || c.GetHeader("Authorization") != "" || !hasSessionCookie(c) {
+			c.Next()
+			return
+		}
+
+		cookie, err := c.Cookie(CSRFTokenCookie)
+		header := c.GetHeader(CSRFHeader)
+		if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+			s.logger.WithFields(logrus.Fields{
+				"method": c.Request.Method,
+				"path":   c.Request.URL.Path,
+			}).Warn("CSRF token mismatch")
+			c.JSON(http.StatusForbidden, gin.H{"error": "invalid CSRF token"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// isStateChanging reports whether the HTTP method may change server state
+func isStateChanging(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	default:
+		return true
+	}
+}
+
+// hasSessionCookie reports whether the request carries an access or refresh token cookie
+func hasSessionCookie(c *gin.Context) bool {
+	for _, name := range []string{AccessTokenCookie, RefreshTokenCookie} {
+		if value, err := c.Cookie(name); err == nil && value != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// generateCSRFToken generates a random CSRF token
+func generateCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
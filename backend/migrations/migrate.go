@@ -11,16 +11,68 @@ import (
 func Migrate(db *gorm.DB) error {
 	logrus.Info("Running database migrations")
 
+	// Users created before email verification existed are treated as verified
+	grandfatherEmails := !db.Migrator().HasColumn(&models.User{}, "email_verified")
+
 	// Auto migrate models
 	err := db.AutoMigrate(
 		&models.User{},
 		&models.Post{},
+		&models.Session{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
+		&models.OAuthState{},
+		&models.LoginCode{},
+		&models.PersonalAccessToken{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.UserIdentity{},
+		&models.RecoveryCode{},
+		&models.MFAChallenge{},
+		&models.RateLimitEntry{},
+		&models.UserBlock{},
+		&models.Friendship{},
+		&models.GroupMembership{},
+		&models.Comment{},
+		&models.Reaction{},
 	)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to run migrations")
 		return err
 	}
 
+	if grandfatherEmails {
+		if err := db.Exec("UPDATE users SET email_verified = ?", true).Error; err != nil {
+			logrus.WithError(err).Error("Failed to mark existing emails as verified")
+			return err
+		}
+	}
+
+	// Record the local identity of users who registered with a password before identities existed
+	err = db.Exec(`INSERT INTO user_identities (id, user_id, provider, subject, email, created_at, last_used_at)
+		SELECT UUID(), users.id, ?, users.id, users.email, NOW(), NOW() FROM users
+		WHERE users.password_hash <> '' AND NOT EXISTS (
+			SELECT 1 FROM user_identities WHERE user_identities.user_id = users.id AND user_identities.provider = ?
+		)`, models.IdentityProviderLocal, models.IdentityProviderLocal).Error
+	if err != nil {
+		logrus.WithError(err).Error("Failed to backfill local identities")
+		return err
+	}
+
+	// Replace the is_public flag of posts with their visibility
+	if db.Migrator().HasColumn(&models.Post{}, "is_public") {
+		err = db.Exec("UPDATE posts SET visibility = CASE WHEN is_public THEN ? ELSE ? END",
+			models.VisibilityPublic, models.VisibilityPrivate).Error
+		if err != nil {
+			logrus.WithError(err).Error("Failed to migrate post visibility")
+			return err
+		}
+		if err := db.Migrator().DropColumn(&models.Post{}, "is_public"); err != nil {
+			logrus.WithError(err).Error("Failed to drop is_public column")
+			return err
+		}
+	}
+
 	logrus.Info("Database migrations completed successfully")
 	return nil
 }
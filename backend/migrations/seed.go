@@ -60,19 +60,19 @@ func seedUsers(db *gorm.DB, count int) ([]models.User, error) {
 // seedTasks creates fake tasks for a user
 func seedTasks(db *gorm.DB, user models.User, count int) error {
 	for i := 0; i < count; i++ {
-		is_public := false
+		visibility := models.VisibilityPrivate
 		if i%2 == 0 {
-			is_public = true
+			visibility = models.VisibilityPublic
 		}
 
 		task := models.Post{
-			ID:        uuid.New().String(),
-			Content:   faker.Sentence(),
-			Caption:   faker.Paragraph(),
-			IsPublic:  is_public,
-			UserID:    user.ID,
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+			ID:         uuid.New().String(),
+			Content:    faker.Sentence(),
+			Caption:    faker.Paragraph(),
+			Visibility: visibility,
+			UserID:     user.ID,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
 		}
 
 		if err := db.Create(&task).Error; err != nil {
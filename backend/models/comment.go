@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Comment represents a comment on a post. Comments are visible to whoever can see
+// their post. Author is only loaded for listings and is never written through the comment.
+type Comment struct {
+	ID        string         `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	PostID    string         `json:"post_id" gorm:"type:varchar(36);index:idx_comments_post_created,priority:1;not null"`
+	UserID    string         `json:"user_id" gorm:"type:varchar(36);index;not null"`
+	Content   string         `json:"content" gorm:"type:text;not null"`
+	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime;index:idx_comments_post_created,priority:2"`
+	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	Author    *UserSummary   `json:"author,omitempty" gorm:"foreignKey:UserID;-:migration"`
+}
+
+// TableName specifies the table name for Comment
+func (Comment) TableName() string {
+	return "comments"
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// EmailVerificationToken represents a single-use token emailed to a newly registered
+// local user to prove they control their email address
+type EmailVerificationToken struct {
+	TokenHash string    `json:"-" gorm:"primaryKey;type:char(64)"`
+	UserID    string    `json:"user_id" gorm:"type:varchar(36);index;not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for EmailVerificationToken
+func (EmailVerificationToken) TableName() string {
+	return "email_verification_tokens"
+}
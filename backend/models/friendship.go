@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// Friendship records that a user is friends with another user. A friendship is
+// stored as two rows, one in each direction, so a user's friends are found by UserID.
+type Friendship struct {
+	UserID    string    `json:"user_id" gorm:"primaryKey;type:varchar(36)"`
+	FriendID  string    `json:"friend_id" gorm:"primaryKey;type:varchar(36);index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for Friendship
+func (Friendship) TableName() string {
+	return "friendships"
+}
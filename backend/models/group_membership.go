@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// GroupMembership records that a user belongs to a group. Members can post to the
+// group and see its posts.
+type GroupMembership struct {
+	GroupID   string    `json:"group_id" gorm:"primaryKey;type:varchar(36)"`
+	UserID    string    `json:"user_id" gorm:"primaryKey;type:varchar(36);index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for GroupMembership
+func (GroupMembership) TableName() string {
+	return "group_memberships"
+}
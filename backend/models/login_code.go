@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginCode represents a short-lived, single-use code handed to the frontend
+// after an OAuth login, which it redeems for tokens at /auth/exchange
+type LoginCode struct {
+	CodeHash  string    `json:"-" gorm:"primaryKey;type:char(64)"`
+	UserID    string    `json:"user_id" gorm:"type:varchar(36);index;not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for LoginCode
+func (LoginCode) TableName() string {
+	return "login_codes"
+}
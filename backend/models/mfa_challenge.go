@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// MFAChallenge represents a primary login that is waiting for the user's second factor.
+// AuthMethods holds the methods of the primary login, carried over to the session.
+type MFAChallenge struct {
+	ChallengeHash string    `json:"-" gorm:"primaryKey;type:char(64)"`
+	UserID        string    `json:"-" gorm:"type:varchar(36);index;not null"`
+	AuthMethods   string    `json:"-" gorm:"type:varchar(64)"`
+	Attempts      int       `json:"-" gorm:"not null;default:0"`
+	ExpiresAt     time.Time `json:"-" gorm:"index;not null"`
+	CreatedAt     time.Time `json:"-" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for MFAChallenge
+func (MFAChallenge) TableName() string {
+	return "mfa_challenges"
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// OAuthState represents a pending OAuth login, stored server-side until the
+// provider redirects back with the matching state parameter. CodeVerifier is
+// the PKCE secret whose S256 challenge was sent with the authorization request,
+// and Nonce must be echoed back in the provider's ID token. LinkUserID is set when
+// the login links a new identity to an already signed-in user.
+type OAuthState struct {
+	StateHash    string    `json:"-" gorm:"primaryKey;type:char(64)"`
+	Provider     string    `json:"provider" gorm:"type:varchar(64);not null"`
+	RedirectTo   string    `json:"redirect_to" gorm:"type:varchar(2048)"`
+	CodeVerifier string    `json:"-" gorm:"type:varchar(128);not null"`
+	Nonce        string    `json:"-" gorm:"type:varchar(64);not null"`
+	LinkUserID   string    `json:"-" gorm:"type:varchar(36)"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index;not null"`
+	CreatedAt    time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for OAuthState
+func (OAuthState) TableName() string {
+	return "oauth_states"
+}
@@ -0,0 +1,13 @@
+package models
+
+// Page is one page of a cursor-paginated listing. Page is the 1-based number of the page.
+// NextCursor is passed back as the cursor query parameter to fetch the following page and
+// is empty on the last one.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	Page       int    `json:"page"`
+	PageSize   int    `json:"pageSize"`
+	HasMore    bool   `json:"hasMore"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
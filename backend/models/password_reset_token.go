@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// PasswordResetToken represents a single-use token emailed to a local user to reset their password
+type PasswordResetToken struct {
+	TokenHash string    `json:"-" gorm:"primaryKey;type:char(64)"`
+	UserID    string    `json:"user_id" gorm:"type:varchar(36);index;not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for PasswordResetToken
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// PersonalAccessToken represents a long-lived token a user creates for scripts and integrations.
+// Only the hash of the token is stored; TokenPrefix lets users recognise it in listings.
+type PersonalAccessToken struct {
+	ID          string     `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserID      string     `json:"user_id" gorm:"type:varchar(36);index;not null"`
+	Name        string     `json:"name" gorm:"type:varchar(100);not null"`
+	TokenHash   string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	TokenPrefix string     `json:"token_prefix" gorm:"type:varchar(16);not null"`
+	Scopes      []Scope    `json:"scopes" gorm:"type:varchar(512);serializer:json;not null"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for PersonalAccessToken
+func (PersonalAccessToken) TableName() string {
+	return "personal_access_tokens"
+}
@@ -6,16 +6,49 @@ import (
 	"gorm.io/gorm"
 )
 
-// Post represents a social media post in the system
+// Visibility controls who can see a post
+type Visibility string
+
+// Visibilities a post can have
+const (
+	// VisibilityPublic posts can be seen by everyone, including anonymous visitors
+	VisibilityPublic Visibility = "public"
+	// VisibilityFriends posts can be seen by the author's friends
+	VisibilityFriends Visibility = "friends"
+	// VisibilityGroup posts can be seen by the members of the post's group
+	VisibilityGroup Visibility = "group"
+	// VisibilityPrivate posts can only be seen by their author
+	VisibilityPrivate Visibility = "private"
+)
+
+// IsValid reports whether the visibility is a known visibility
+func (v Visibility) IsValid() bool {
+	switch v {
+	case VisibilityPublic, VisibilityFriends, VisibilityGroup, VisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// Post represents a social media post in the system. GroupID is only set for posts with
+// group visibility. CommentsCount is maintained by the CommentService. Author, and the
+// reaction counts and reactions of the viewer, are only loaded for reads and are never
+// written through the post.
 type Post struct {
-	ID        string         `json:"id" gorm:"primaryKey;type:varchar(36)"`
-	Content   string         `json:"content" binding:"required" gorm:"type:text;not null"`
-	Caption   string         `json:"caption" gorm:"type:varchar(255)"`
-	IsPublic  bool           `json:"is_public" gorm:"default:true"`
-	UserID    string         `json:"user_id" gorm:"type:varchar(36);index;not null"`
-	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              string                 `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	Content         string                 `json:"content" binding:"required" gorm:"type:text;not null"`
+	Caption         string                 `json:"caption" gorm:"type:varchar(255)"`
+	Visibility      Visibility             `json:"visibility" gorm:"type:varchar(10);not null;default:'public';index"`
+	GroupID         string                 `json:"group_id,omitempty" gorm:"type:varchar(36);index"`
+	CommentsCount   int                    `json:"comments_count" gorm:"not null;default:0"`
+	UserID          string                 `json:"user_id" gorm:"type:varchar(36);index;index:idx_posts_user_created,priority:1;not null"`
+	CreatedAt       time.Time              `json:"created_at" gorm:"autoCreateTime;index;index:idx_posts_user_created,priority:2"`
+	UpdatedAt       time.Time              `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt       gorm.DeletedAt         `json:"-" gorm:"index"`
+	Author          *UserSummary           `json:"author,omitempty" gorm:"foreignKey:UserID;-:migration"`
+	ReactionCounts  map[ReactionKind]int64 `json:"reaction_counts" gorm:"-"`
+	LikesCount      int64                  `json:"likes_count" gorm:"-"`
+	ViewerReactions []ReactionKind         `json:"viewer_reactions" gorm:"-"`
 }
 
 // TableName specifies the table name for Post
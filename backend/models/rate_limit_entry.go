@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// RateLimitEntry holds the state of a rate limit key: the token bucket of request
+// rate limits, or the failure count and lockout of login backoff
+type RateLimitEntry struct {
+	BucketKey    string    `json:"key" gorm:"primaryKey;type:varchar(255)"`
+	Tokens       float64   `json:"tokens" gorm:"not null;default:0"`
+	Failures     int       `json:"failures" gorm:"not null;default:0"`
+	BlockedUntil time.Time `json:"blocked_until"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index;not null"`
+}
+
+// TableName specifies the table name for RateLimitEntry
+func (RateLimitEntry) TableName() string {
+	return "rate_limit_entries"
+}
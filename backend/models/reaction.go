@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+)
+
+// ReactionKind is the kind of a reaction to a post
+type ReactionKind string
+
+// Reaction kinds a user can give a post. A like is the plain reaction counted as likes_count.
+const (
+	ReactionLike  ReactionKind = "like"
+	ReactionLove  ReactionKind = "love"
+	ReactionLaugh ReactionKind = "laugh"
+	ReactionWow   ReactionKind = "wow"
+	ReactionSad   ReactionKind = "sad"
+	ReactionAngry ReactionKind = "angry"
+)
+
+// AllReactionKinds lists every reaction kind
+var AllReactionKinds = []ReactionKind{ReactionLike, ReactionLove, ReactionLaugh, ReactionWow, ReactionSad, ReactionAngry}
+
+// IsValid reports whether the reaction kind is a known kind
+func (k ReactionKind) IsValid() bool {
+	for _, kind := range AllReactionKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Reaction records that a user reacted to a post with a kind of reaction. A user can
+// give a post several kinds of reaction, but each kind only once.
+type Reaction struct {
+	PostID    string       `json:"post_id" gorm:"primaryKey;type:varchar(36)"`
+	UserID    string       `json:"user_id" gorm:"primaryKey;type:varchar(36);index"`
+	Kind      ReactionKind `json:"kind" gorm:"primaryKey;type:varchar(10)"`
+	CreatedAt time.Time    `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for Reaction
+func (Reaction) TableName() string {
+	return "reactions"
+}
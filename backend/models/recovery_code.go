@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode represents a single-use code that replaces a TOTP code when the
+// user has lost their authenticator. Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        string     `json:"-" gorm:"primaryKey;type:varchar(36)"`
+	UserID    string     `json:"-" gorm:"type:varchar(36);index;not null"`
+	CodeHash  string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	UsedAt    *time.Time `json:"-"`
+	CreatedAt time.Time  `json:"-" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for RecoveryCode
+func (RecoveryCode) TableName() string {
+	return "recovery_codes"
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken represents a hashed refresh token issued for a session.
+// Rotation keeps the SessionID so that a replayed (already rotated) token can
+// revoke the whole session. AccessTokenID and AccessTokenExpiresAt identify the
+// JWT issued alongside the refresh token so it can be revoked with the session.
+type RefreshToken struct {
+	ID                   string     `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserID               string     `json:"user_id" gorm:"type:varchar(36);index;not null"`
+	SessionID            string     `json:"session_id" gorm:"type:varchar(36);index;not null"`
+	TokenHash            string     `json:"-" gorm:"type:char(64);uniqueIndex;not null"`
+	ExpiresAt            time.Time  `json:"expires_at" gorm:"not null"`
+	AccessTokenID        string     `json:"-" gorm:"type:varchar(36);index"`
+	AccessTokenExpiresAt time.Time  `json:"-"`
+	RevokedAt            *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID         string     `json:"-" gorm:"type:varchar(36)"`
+	CreatedAt            time.Time  `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for RefreshToken
+func (RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
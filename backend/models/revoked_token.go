@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// RevokedToken represents a JWT that was revoked before its expiry, keyed by its jti
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey;type:varchar(36)"`
+	UserID    string    `json:"user_id" gorm:"type:varchar(36);index"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index;not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for RevokedToken
+func (RevokedToken) TableName() string {
+	return "revoked_tokens"
+}
@@ -0,0 +1,54 @@
+package models
+
+// Role is the access level of a user
+type Role string
+
+// Roles a user can have, in increasing order of privilege
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// Permission is an action that is granted to roles through the permission matrix
+type Permission string
+
+// Permissions checked by RequirePermission
+const (
+	// PermissionModerateContent allows editing or removing other users' content
+	PermissionModerateContent Permission = "content:moderate"
+	// PermissionManageUsers allows changing roles and terminating other users' sessions
+	PermissionManageUsers Permission = "users:manage"
+)
+
+// rolePermissions is the permission matrix
+var rolePermissions = map[Role][]Permission{
+	RoleUser:      {},
+	RoleModerator: {PermissionModerateContent},
+	RoleAdmin:     {PermissionModerateContent, PermissionManageUsers},
+}
+
+// IsValid reports whether the role is a known role
+func (r Role) IsValid() bool {
+	_, ok := rolePermissions[r]
+	return ok
+}
+
+// HasPermission reports whether the role is granted the permission
+func (r Role) HasPermission(permission Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultScopes returns the scopes granted to interactive logins of a user with this role
+func (r Role) DefaultScopes() []Scope {
+	scopes := []Scope{ScopePostsRead, ScopePostsWrite}
+	if r == RoleAdmin {
+		scopes = append(scopes, ScopeAdmin)
+	}
+	return scopes
+}
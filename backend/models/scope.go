@@ -0,0 +1,56 @@
+package models
+
+import (
+	"strings"
+)
+
+// Scope is an OAuth-style permission carried by a token
+type Scope string
+
+// Scopes that can be granted to tokens
+const (
+	ScopePostsRead  Scope = "posts:read"
+	ScopePostsWrite Scope = "posts:write"
+	ScopeAdmin      Scope = "admin"
+)
+
+// AllScopes lists every scope that can be granted
+var AllScopes = []Scope{ScopePostsRead, ScopePostsWrite, ScopeAdmin}
+
+// IsValid reports whether the scope is a known scope
+func (s Scope) IsValid() bool {
+	for _, scope := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// JoinScopes formats scopes as the space-delimited "scope" claim value
+func JoinScopes(scopes []Scope) string {
+	values := make([]string, len(scopes))
+	for i, scope := range scopes {
+		values[i] = string(scope)
+	}
+	return strings.Join(values, " ")
+}
+
+// ParseScopes parses a space-delimited "scope" claim value
+func ParseScopes(value string) []Scope {
+	var scopes []Scope
+	for _, field := range strings.Fields(value) {
+		scopes = append(scopes, Scope(field))
+	}
+	return scopes
+}
+
+// HasScope reports whether scopes contains scope
+func HasScope(scopes []Scope, scope Scope) bool {
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
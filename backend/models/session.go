@@ -0,0 +1,55 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Session represents a login on a device. Every JWT and refresh token issued
+// from that login carries the session ID, so revoking the session signs the
+// device out. AuthMethods is the space-separated list of authentication methods
+// used, and AuthTime when the user last authenticated on it.
+type Session struct {
+	ID             string     `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserID         string     `json:"user_id" gorm:"type:varchar(36);index;not null"`
+	DeviceID       string     `json:"device_id" gorm:"type:varchar(255)"`
+	UserAgent      string     `json:"user_agent" gorm:"type:varchar(512)"`
+	IPAddress      string     `json:"ip_address" gorm:"type:varchar(45)"`
+	CurrentTokenID string     `json:"-" gorm:"type:varchar(36);index"`
+	AuthMethods    string     `json:"auth_methods" gorm:"type:varchar(64)"`
+	AuthTime       time.Time  `json:"auth_time"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt      *time.Time `json:"-"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"autoCreateTime"`
+	LastSeenAt     time.Time  `json:"last_seen_at"`
+	Current        bool       `json:"current" gorm:"-"`
+}
+
+// AMR returns the authentication methods of the session
+func (s *Session) AMR() []string {
+	return strings.Fields(s.AuthMethods)
+}
+
+// Authentication method references (RFC 8176) recorded on sessions and carried in the amr claim
+const (
+	// AuthMethodPassword is a local password login
+	AuthMethodPassword = "pwd"
+	// AuthMethodFederated is a login through an external identity provider
+	AuthMethodFederated = "fed"
+	// AuthMethodOTP is a TOTP code
+	AuthMethodOTP = "otp"
+	// AuthMethodMFA marks a session that completed a second factor
+	AuthMethodMFA = "mfa"
+)
+
+// TableName specifies the table name for Session
+func (Session) TableName() string {
+	return "sessions"
+}
+
+// DeviceInfo describes the client a session is created for
+type DeviceInfo struct {
+	DeviceID  string
+	UserAgent string
+	IPAddress string
+}
@@ -6,15 +6,30 @@ import (
 	"gorm.io/gorm"
 )
 
-// User represents a user in the social media system
+// User represents a user in the social media system. PasswordHash is only set for
+// users of the local credentials provider. EmailVerified is set once the user has
+// proven control of Email, by a verification link or a provider that vouches for it.
+// TOTPSecret is set when two-factor enrollment starts and TOTPEnabled once the first
+// code is confirmed; TOTPLastStep is the time step of the last accepted code, so codes
+// cannot be replayed. AvatarKey is the blob store key of the avatar served at
+// AvatarURL, and AvatarETag the ETag of the provider photo it was copied from.
 type User struct {
-	ID        string         `json:"id" gorm:"primaryKey;type:varchar(36)"`
-	Email     string         `json:"email" gorm:"type:varchar(255);uniqueIndex;not null"`
-	Name      string         `json:"username" gorm:"type:varchar(255);uniqueIndex;not null"`
-	CreatedAt time.Time      `json:"created_at" gorm:"autoCreateTime"`
-	UpdatedAt time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
-	Posts     []Post         `json:"posts,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	ID            string         `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	Email         string         `json:"email" gorm:"type:varchar(255);uniqueIndex;not null"`
+	Name          string         `json:"username" gorm:"type:varchar(255);uniqueIndex;not null"`
+	Role          Role           `json:"role" gorm:"type:varchar(20);not null;default:'user'"`
+	EmailVerified bool           `json:"email_verified" gorm:"not null;default:false"`
+	PasswordHash  string         `json:"-" gorm:"type:varchar(255)"`
+	TOTPSecret    string         `json:"-" gorm:"column:totp_secret;type:varchar(64)"`
+	TOTPEnabled   bool           `json:"totp_enabled" gorm:"column:totp_enabled;not null;default:false"`
+	TOTPLastStep  int64          `json:"-" gorm:"column:totp_last_step;not null;default:0"`
+	AvatarURL     string         `json:"avatar_url" gorm:"type:varchar(2048)"`
+	AvatarKey     string         `json:"-" gorm:"type:varchar(255)"`
+	AvatarETag    string         `json:"-" gorm:"column:avatar_etag;type:varchar(255)"`
+	CreatedAt     time.Time      `json:"created_at" gorm:"autoCreateTime"`
+	UpdatedAt     time.Time      `json:"updated_at" gorm:"autoUpdateTime"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+	Posts         []Post         `json:"posts,omitempty" gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
 }
 
 // TableName specifies the table name for User
@@ -24,9 +39,10 @@ func (User) TableName() string {
 
 // TokenDetails contains the JWT token details
 type TokenDetails struct {
-	AccessToken  string    `json:"access_token"`
+	AccessToken  string    `json:"access_token,omitempty"`
 	RefreshToken string    `json:"refresh_token,omitempty"`
 	TokenType    string    `json:"token_type"`
 	ExpiresIn    int64     `json:"expires_in"`
 	ExpiresAt    time.Time `json:"-"`
+	TokenID      string    `json:"-"`
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// UserBlock records that a user has blocked another user. Posts of blocked users
+// are hidden from the blocker's feed.
+type UserBlock struct {
+	BlockerID string    `json:"blocker_id" gorm:"primaryKey;type:varchar(36)"`
+	BlockedID string    `json:"blocked_id" gorm:"primaryKey;type:varchar(36);index"`
+	CreatedAt time.Time `json:"created_at" gorm:"autoCreateTime"`
+}
+
+// TableName specifies the table name for UserBlock
+func (UserBlock) TableName() string {
+	return "user_blocks"
+}
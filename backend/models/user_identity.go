@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// IdentityProviderLocal is the provider name of identities backed by a local password
+const IdentityProviderLocal = "local"
+
+// UserIdentity links a user to an account at an identity provider. Subject is the
+// provider's immutable user identifier (the oid for Microsoft), so renaming the
+// account or changing its email does not create a new user.
+type UserIdentity struct {
+	ID         string    `json:"id" gorm:"primaryKey;type:varchar(36)"`
+	UserID     string    `json:"-" gorm:"type:varchar(36);index;not null"`
+	Provider   string    `json:"provider" gorm:"type:varchar(64);uniqueIndex:idx_identity_provider_subject;not null"`
+	Subject    string    `json:"-" gorm:"type:varchar(255);uniqueIndex:idx_identity_provider_subject;not null"`
+	Email      string    `json:"email" gorm:"type:varchar(255)"`
+	CreatedAt  time.Time `json:"created_at" gorm:"autoCreateTime"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// TableName specifies the table name for UserIdentity
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
@@ -0,0 +1,13 @@
+package models
+
+// UserSummary is the public part of a user, embedded as the author of posts
+type UserSummary struct {
+	ID        string `json:"id"`
+	Name      string `json:"username"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// TableName specifies the table name for UserSummary
+func (UserSummary) TableName() string {
+	return "users"
+}
@@ -4,9 +4,9 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
-	"net/http"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,35 +15,76 @@ import (
 	"go-azure/models"
 	"go-azure/utils"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/microsoft"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or bound to another device
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	// ErrInvalidState is returned when an OAuth state is unknown, expired or already used
+	ErrInvalidState = errors.New("invalid state")
+	// ErrInvalidLoginCode is returned when a login code is unknown, expired or already redeemed
+	ErrInvalidLoginCode = errors.New("invalid login code")
+	// ErrSessionNotFound is returned when a session does not exist or belongs to another user
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrTokenRevoked is returned when a JWT has been revoked before its expiry
+	ErrTokenRevoked = errors.New("token has been revoked")
+	// ErrTenantNotAllowed is returned when a Microsoft account belongs to a tenant outside ALLOWED_TENANT_IDS
+	ErrTenantNotAllowed = errors.New("tenant not allowed")
+	// ErrDomainNotAllowed is returned when an email address is outside ALLOWED_EMAIL_DOMAINS
+	ErrDomainNotAllowed = errors.New("email domain not allowed")
+	// ErrDomainUnverified is returned when ALLOWED_EMAIL_DOMAINS is set and the email is not verified
+	ErrDomainUnverified = errors.New("email domain cannot be checked without a verified email")
+	// ErrNotInvited is returned in invite-only mode when no user was provisioned for the email
+	ErrNotInvited = errors.New("user has not been invited")
+	// ErrEmailInUse is returned when a new identity's email belongs to a user who already has other identities
+	ErrEmailInUse = errors.New("email belongs to an existing account")
+	// ErrIdentityInUse is returned when linking an identity that is already linked to another user
+	ErrIdentityInUse = errors.New("identity is linked to another account")
+	// ErrIdentityNotFound is returned when an identity does not exist or belongs to another user
+	ErrIdentityNotFound = errors.New("identity not found")
+	// ErrEmailNotVerified is returned when an identity would be matched to an existing user
+	// by an email address the provider does not vouch for; it has to be linked from a
+	// signed-in session instead
+	ErrEmailNotVerified = errors.New("email not verified by provider, link this account from an authenticated session")
+	// ErrLastIdentity is returned when unlinking the only identity a user can sign in with
+	ErrLastIdentity = errors.New("cannot unlink the last identity")
 )
 
 // AuthService handles authentication operations
 type AuthService struct {
-	config *config.Config
-	logger *logrus.Logger
-	db     *gorm.DB
+	config      *config.Config
+	logger      *logrus.Logger
+	db          *gorm.DB
+	revocations RevocationStore
+	providers   map[string]IdentityProvider
+	keys        *utils.KeySet
+	blobs       BlobStore
 }
 
 // NewAuthService creates a new AuthService
-func NewAuthService(config *config.Config) *AuthService {
+func NewAuthService(config *config.Config, revocations RevocationStore, keys *utils.KeySet, blobs BlobStore) *AuthService {
 	return &AuthService{
-		config: config,
-		logger: utils.GetLogger(),
-		db:     utils.GetDB(),
+		config:      config,
+		logger:      utils.GetLogger(),
+		db:          utils.GetDB(),
+		revocations: revocations,
+		keys:        keys,
+		blobs:       blobs,
+		providers:   NewIdentityProviders(config),
 	}
 }
 
-// GetMicrosoftOAuthConfig returns the OAuth2 config for Microsoft
-func (s *AuthService) GetMicrosoftOAuthConfig() *oauth2.Config {
-	return &oauth2.Config{
-		ClientID:     s.config.MicrosoftClientID,
-		ClientSecret: s.config.MicrosoftClientSecret,
-		RedirectURL:  s.config.MicrosoftRedirectURI,
-		Scopes:       []string{"openid", "profile", "email", "offline_access", "User.Read"},
-		Endpoint:     microsoft.AzureADEndpoint(s.config.MicrosoftTenantID),
+// GetProvider returns the identity provider registered under name
+func (s *AuthService) GetProvider(name string) (IdentityProvider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
 	}
+	return provider, nil
 }
 
 // GenerateState generates a random state string for OAuth
@@ -53,127 +94,899 @@ func (s *AuthService) GenerateState() (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return base64.StdEncoding.EncodeToString(b), nil
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateLoginState generates a state, a nonce and a PKCE code verifier and stores them server-side
+// together with the provider and the frontend path the user should return to after login.
+// A non-empty linkUserID links the provider account to that user instead of signing in.
+// It returns the raw state, which is only stored hashed.
+func (s *AuthService) CreateLoginState(provider string, redirectTo string, linkUserID string) (string, *models.OAuthState, error) {
+	state, err := s.GenerateState()
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce, err := s.GenerateState()
+	if err != nil {
+		return "", nil, err
+	}
+
+	loginState := models.OAuthState{
+		StateHash:    utils.HashToken(state),
+		Provider:     provider,
+		RedirectTo:   redirectTo,
+		LinkUserID:   linkUserID,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		Nonce:        nonce,
+		ExpiresAt:    time.Now().Add(time.Minute * time.Duration(s.config.OAuthStateTTLMinutes)),
+	}
+	if err := s.db.Create(&loginState).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to store OAuth state")
+		return "", nil, errors.New("failed to store state")
+	}
+
+	return state, &loginState, nil
+}
+
+// ConsumeLoginState validates a state returned by the provider and removes it so it cannot be used again
+func (s *AuthService) ConsumeLoginState(state string) (*models.OAuthState, error) {
+	if state == "" {
+		return nil, ErrInvalidState
+	}
+
+	var loginState models.OAuthState
+	result := s.db.Where("state_hash = ?", utils.HashToken(state)).First(&loginState)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidState
+		}
+		s.logger.WithError(result.Error).Error("Failed to query OAuth state")
+		return nil, errors.New("failed to query state")
+	}
+
+	// Deleting the row is what consumes the state; a concurrent callback loses the race
+	result = s.db.Where("state_hash = ?", loginState.StateHash).Delete(&models.OAuthState{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to consume OAuth state")
+		return nil, errors.New("failed to consume state")
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidState
+	}
+
+	if time.Now().After(loginState.ExpiresAt) {
+		return nil, ErrInvalidState
+	}
+
+	return &loginState, nil
 }
 
-// GetMicrosoftLoginURL returns the URL for Microsoft login
-func (s *AuthService) GetMicrosoftLoginURL(state string) string {
-	return s.GetMicrosoftOAuthConfig().AuthCodeURL(state)
+// PurgeExpiredLoginStates removes OAuth states that were never completed
+func (s *AuthService) PurgeExpiredLoginStates() error {
+	return s.db.Where("expires_at <= ?", time.Now()).Delete(&models.OAuthState{}).Error
 }
 
-// HandleMicrosoftCallback handles the callback from Microsoft OAuth
-func (s *AuthService) HandleMicrosoftCallback(code string) (*models.TokenDetails, *models.User, error) {
-	// Exchange code for token
-	oauth2Config := s.GetMicrosoftOAuthConfig()
-	token, err := oauth2Config.Exchange(context.Background(), code)
+// HandleProviderCallback exchanges the authorization code with the provider and resolves
+// the local user for the returned profile, creating it on first sign-in
+func (s *AuthService) HandleProviderCallback(ctx context.Context, provider IdentityProvider, code string, loginState *models.OAuthState) (*models.User, error) {
+	profile, err := s.exchangeProfile(ctx, provider, code, loginState)
 	if err != nil {
-		s.logger.WithError(err).Error("Failed to exchange code for token")
-		return nil, nil, err
+		return nil, err
 	}
 
-	// Get user info
-	userInfo, err := s.getUserInfo(token.AccessToken)
+	user, err := s.resolveUser(profile)
 	if err != nil {
-		s.logger.WithError(err).Error("Failed to get user info")
-		return nil, nil, err
+		return nil, err
+	}
+
+	// Keep the avatar in sync with the provider's profile photo
+	if photos, ok := provider.(PhotoProvider); ok {
+		s.syncAvatar(photos, profile, user)
+	}
+
+	return user, nil
+}
+
+// resolveUser returns the user of an external profile, creating it on first sign-in
+func (s *AuthService) resolveUser(profile *ExternalProfile) (*models.User, error) {
+	// Look up the user by the provider's immutable subject
+	var identity models.UserIdentity
+	result := s.db.Where("provider = ? AND subject = ?", profile.Provider, profile.Subject).First(&identity)
+	if result.Error == nil {
+		return s.signInIdentity(&identity, profile)
+	}
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		s.logger.WithError(result.Error).Error("Failed to query identity")
+		return nil, errors.New("failed to query identity")
 	}
 
-	// Check if user exists in database
+	// Unknown identity: claim an existing user by email or create a new one
 	var user models.User
+	isNew := false
 
-	result := s.db.Where("email = ?", userInfo["userPrincipalName"].(string)).First(&user)
+	// Invitations are matched by email, which means nothing unless the provider verified it
+	if s.config.InviteOnly && !profile.EmailVerified {
+		s.logger.WithField("provider", profile.Provider).Warn("Sign-in rejected, unverified email in invite-only mode")
+		return nil, ErrNotInvited
+	}
 
+	result = s.db.Where("LOWER(email) = ?", strings.ToLower(profile.Email)).First(&user)
 	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			// Create new user
-			user = models.User{
-				ID:        uuid.New().String(),
-				Email:     userInfo["userPrincipalName"].(string),
-				Name:      userInfo["displayName"].(string),
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			s.logger.WithError(result.Error).Error("Failed to query user")
+			return nil, errors.New("failed to query user")
+		}
+
+		// In invite-only mode users must have been provisioned by an admin
+		if s.config.InviteOnly {
+			s.logger.WithField("email", profile.Email).Warn("Sign-in rejected, user not invited")
+			return nil, ErrNotInvited
+		}
+
+		// Create new user
+		isNew = true
+		user = models.User{
+			ID:            uuid.New().String(),
+			Email:         profile.Email,
+			Role:          models.RoleUser,
+			EmailVerified: profile.EmailVerified,
+			CreatedAt:     time.Now(),
+		}
+	} else {
+		// Claiming an account by email is only safe when the provider vouches for the address
+		if !profile.EmailVerified {
+			s.logger.WithFields(logrus.Fields{
+				"user_id":  user.ID,
+				"provider": profile.Provider,
+			}).Warn("Sign-in rejected, unverified email matches an existing user")
+			return nil, ErrEmailNotVerified
+		}
+
+		// A local registration that never verified the address does not belong to its owner;
+		// the verified owner takes the account over and the unproven password is discarded
+		if !user.EmailVerified && user.PasswordHash != "" {
+			err := s.db.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Where("user_id = ? AND provider = ?", user.ID, models.IdentityProviderLocal).Delete(&models.UserIdentity{}).Error; err != nil {
+					return err
+				}
+				return tx.Model(&user).Update("password_hash", "").Error
+			})
+			if err != nil {
+				s.logger.WithError(err).Error("Failed to discard unverified local credentials")
+				return nil, errors.New("failed to save user")
 			}
+			s.logger.WithFields(logrus.Fields{
+				"user_id":  user.ID,
+				"provider": profile.Provider,
+			}).Warn("Unverified local registration taken over by verified email owner")
+		}
+		user.EmailVerified = true
+
+		// Only users without identities, who signed in before identities were recorded or were
+		// provisioned by an admin, are claimed by email. Everyone else has to link explicitly.
+		var count int64
+		if err := s.db.Model(&models.UserIdentity{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to query identities")
+			return nil, errors.New("failed to query identities")
+		}
+		if count > 0 {
+			s.logger.WithFields(logrus.Fields{
+				"user_id":  user.ID,
+				"provider": profile.Provider,
+			}).Warn("Sign-in rejected, email belongs to a user with other identities")
+			return nil, ErrEmailInUse
+		}
+	}
 
-			// Save user to database
-			if err := s.db.Create(&user).Error; err != nil {
-				s.logger.WithError(err).Error("Failed to create user")
-				return nil, nil, errors.New("failed to create user")
+	// Update user information
+	user.Name = profile.Name
+	user.UpdatedAt = time.Now()
+	if profile.EmailVerified {
+		s.applyAdminBootstrap(&user)
+	}
+
+	identity = newUserIdentity(user.ID, profile.Provider, profile.Subject, profile.Email)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if isNew {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
 			}
+		} else if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to save user")
+		return nil, errors.New("failed to save user")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"email":    user.Email,
+		"provider": profile.Provider,
+		"new_user": isNew,
+	}).Info("User identity created")
 
+	return &user, nil
+}
+
+// exchangeProfile exchanges the authorization code for the user's profile and
+// enforces the tenant and email domain allowlists. ctx is the caller's request context,
+// so a client that goes away cancels the call to the provider.
+func (s *AuthService) exchangeProfile(ctx context.Context, provider IdentityProvider, code string, loginState *models.OAuthState) (*ExternalProfile, error) {
+	// Exchange code for the user's verified profile
+	profile, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		s.logger.WithError(err).WithField("provider", provider.Name()).Error("Failed to exchange code for profile")
+		return nil, err
+	}
+
+	if err := s.CheckSignInAllowed(profile.Provider, profile.TenantID, profile.Email, profile.EmailVerified); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"provider":  profile.Provider,
+			"tenant_id": profile.TenantID,
+			"email":     profile.Email,
+		}).WithError(err).Warn("Sign-in rejected")
+		return nil, err
+	}
+
+	return profile, nil
+}
+
+// signInIdentity updates the user of a known identity with the latest profile
+func (s *AuthService) signInIdentity(identity *models.UserIdentity, profile *ExternalProfile) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("id = ?", identity.UserID).First(&user).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get user for identity")
+		return nil, errors.New("failed to get user")
+	}
+
+	// Follow verified email changes at the provider unless another user already has the new address
+	if profile.EmailVerified && profile.Email != "" && !strings.EqualFold(profile.Email, user.Email) {
+		var count int64
+		err := s.db.Model(&models.User{}).Where("LOWER(email) = ? AND id <> ?", profile.Email, user.ID).Count(&count).Error
+		if err != nil {
+			// Keep the current email rather than risk taking another user's address
+			s.logger.WithError(err).Error("Failed to query users by email")
+		} else if count == 0 {
+			user.Email = profile.Email
+		}
+	}
+
+	// Update user information
+	user.Name = profile.Name
+	user.UpdatedAt = time.Now()
+	if profile.EmailVerified {
+		s.applyAdminBootstrap(&user)
+	}
+
+	identity.Email = profile.Email
+	identity.LastUsedAt = time.Now()
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		return tx.Save(identity).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to update user")
+		return nil, errors.New("failed to update user")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+		"email":   user.Email,
+	}).Info("Existing user updated")
+
+	return &user, nil
+}
+
+// LinkProviderIdentity exchanges the authorization code with the provider and links
+// the returned account to the user who started the link
+func (s *AuthService) LinkProviderIdentity(ctx context.Context, provider IdentityProvider, code string, loginState *models.OAuthState) (*models.UserIdentity, error) {
+	profile, err := s.exchangeProfile(ctx, provider, code, loginState)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity models.UserIdentity
+	result := s.db.Where("provider = ? AND subject = ?", profile.Provider, profile.Subject).First(&identity)
+	if result.Error == nil {
+		if identity.UserID != loginState.LinkUserID {
+			s.logger.WithFields(logrus.Fields{
+				"user_id":  loginState.LinkUserID,
+				"provider": profile.Provider,
+			}).Warn("Identity already linked to another user")
+			return nil, ErrIdentityInUse
+		}
+		// Already linked to this user
+		return &identity, nil
+	}
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		s.logger.WithError(result.Error).Error("Failed to query identity")
+		return nil, errors.New("failed to query identity")
+	}
+
+	identity = newUserIdentity(loginState.LinkUserID, profile.Provider, profile.Subject, profile.Email)
+	if err := s.db.Create(&identity).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to link identity")
+		return nil, errors.New("failed to link identity")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  identity.UserID,
+		"provider": identity.Provider,
+	}).Info("Identity linked")
+
+	return &identity, nil
+}
+
+// ListIdentities returns the identities linked to a user
+func (s *AuthService) ListIdentities(userID string) ([]models.UserIdentity, error) {
+	var identities []models.UserIdentity
+	result := s.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&identities)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to get identities")
+		return nil, errors.New("failed to get identities")
+	}
+
+	return identities, nil
+}
+
+// UnlinkIdentity removes an identity from a user. The last identity cannot be removed,
+// since the user would no longer be able to sign in.
+func (s *AuthService) UnlinkIdentity(userID string, identityID string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Lock the user's identities so concurrent unlinks cannot remove the last two together
+		var identities []models.UserIdentity
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).
+			Find(&identities).Error
+		if err != nil {
+			return err
+		}
+
+		var identity *models.UserIdentity
+		for i := range identities {
+			if identities[i].ID == identityID {
+				identity = &identities[i]
+			}
+		}
+		if identity == nil {
+			return ErrIdentityNotFound
+		}
+		if len(identities) == 1 {
+			return ErrLastIdentity
+		}
+
+		if err := tx.Delete(identity).Error; err != nil {
+			return err
+		}
+
+		// Unlinking the local identity removes the password
+		if identity.Provider == models.IdentityProviderLocal {
+			return tx.Model(&models.User{}).Where("id = ?", userID).Update("password_hash", "").Error
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrIdentityNotFound) || errors.Is(err, ErrLastIdentity) {
+			return err
+		}
+		s.logger.WithError(err).Error("Failed to unlink identity")
+		return errors.New("failed to unlink identity")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":     userID,
+		"identity_id": identityID,
+	}).Info("Identity unlinked")
+
+	return nil
+}
+
+// newUserIdentity creates a new identity record for a user
+func newUserIdentity(userID string, provider string, subject string, email string) models.UserIdentity {
+	return models.UserIdentity{
+		ID:         uuid.New().String(),
+		UserID:     userID,
+		Provider:   provider,
+		Subject:    subject,
+		Email:      email,
+		LastUsedAt: time.Now(),
+	}
+}
+
+// CheckSignInAllowed enforces ALLOWED_TENANT_IDS for Microsoft accounts and
+// ALLOWED_EMAIL_DOMAINS for every account. The domain of an unverified email proves
+// nothing, so such accounts are rejected outright while the domain allowlist is set.
+// Microsoft emails only count as verified when they come from a trusted tenant.
+func (s *AuthService) CheckSignInAllowed(provider string, tenantID string, email string, emailVerified bool) error {
+	if provider == "microsoft" && len(s.config.AllowedTenantIDs) > 0 && !containsFold(s.config.AllowedTenantIDs, tenantID) {
+		return ErrTenantNotAllowed
+	}
+
+	if len(s.config.AllowedEmailDomains) > 0 {
+		if !emailVerified {
+			return ErrDomainUnverified
+		}
+		if !s.emailDomainAllowed(email) {
+			return ErrDomainNotAllowed
+		}
+	}
+
+	return nil
+}
+
+// emailDomainAllowed reports whether the domain of email is in ALLOWED_EMAIL_DOMAINS
+func (s *AuthService) emailDomainAllowed(email string) bool {
+	if len(s.config.AllowedEmailDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	return at >= 0 && containsFold(s.config.AllowedEmailDomains, email[at+1:])
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyAdminBootstrap promotes users listed in ADMIN_EMAILS to admin, so a fresh
+// deployment has someone who can assign roles. It never demotes anyone.
+func (s *AuthService) applyAdminBootstrap(user *models.User) {
+	for _, email := range s.config.AdminEmails {
+		if strings.EqualFold(email, user.Email) && user.Role != models.RoleAdmin {
+			user.Role = models.RoleAdmin
 			s.logger.WithFields(logrus.Fields{
 				"user_id": user.ID,
 				"email":   user.Email,
-			}).Info("New user created")
-		} else {
-			s.logger.WithError(result.Error).Error("Failed to query user")
-			return nil, nil, errors.New("failed to query user")
+			}).Info("User promoted to admin from ADMIN_EMAILS")
+			return
 		}
-	} else {
-		// Update user information
-		user.Name = userInfo["displayName"].(string)
-		user.UpdatedAt = time.Now()
+	}
+}
+
+// CreateLoginCode issues a single-use code the frontend can redeem for the user's tokens
+func (s *AuthService) CreateLoginCode(userID string) (string, error) {
+	code, err := s.GenerateState()
+	if err != nil {
+		return "", err
+	}
 
-		if err := s.db.Save(&user).Error; err != nil {
-			s.logger.WithError(err).Error("Failed to update user")
-			return nil, nil, errors.New("failed to update user")
+	loginCode := models.LoginCode{
+		CodeHash:  utils.HashToken(code),
+		UserID:    userID,
+		ExpiresAt: time.Now().Add(time.Second * time.Duration(s.config.LoginCodeTTLSeconds)),
+	}
+	if err := s.db.Create(&loginCode).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to store login code")
+		return "", errors.New("failed to store login code")
+	}
+
+	return code, nil
+}
+
+// RedeemLoginCode consumes a login code and returns the user who signed in with it
+func (s *AuthService) RedeemLoginCode(code string) (*models.User, error) {
+	var loginCode models.LoginCode
+	result := s.db.Where("code_hash = ?", utils.HashToken(code)).First(&loginCode)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidLoginCode
 		}
+		s.logger.WithError(result.Error).Error("Failed to query login code")
+		return nil, errors.New("failed to query login code")
+	}
+
+	// Deleting the row is what redeems the code; a concurrent exchange loses the race
+	result = s.db.Where("code_hash = ?", loginCode.CodeHash).Delete(&models.LoginCode{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to redeem login code")
+		return nil, errors.New("failed to redeem login code")
+	}
+	if result.RowsAffected == 0 || time.Now().After(loginCode.ExpiresAt) {
+		return nil, ErrInvalidLoginCode
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", loginCode.UserID).First(&user).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get user for login code")
+		return nil, ErrInvalidLoginCode
+	}
 
+	return &user, nil
+}
+
+// PurgeExpiredLoginCodes removes login codes that were never redeemed
+func (s *AuthService) PurgeExpiredLoginCodes() error {
+	return s.db.Where("expires_at <= ?", time.Now()).Delete(&models.LoginCode{}).Error
+}
+
+// IssueTokens starts a new session for the device and issues its first JWT and refresh token.
+// authMethods are the authentication methods the user signed in with, carried in the amr claim.
+func (s *AuthService) IssueTokens(user *models.User, device *models.DeviceInfo, authMethods []string) (*models.TokenDetails, error) {
+	session := models.Session{
+		ID:          uuid.New().String(),
+		UserID:      user.ID,
+		DeviceID:    device.DeviceID,
+		UserAgent:   device.UserAgent,
+		IPAddress:   device.IPAddress,
+		AuthMethods: strings.Join(authMethods, " "),
+		AuthTime:    time.Now(),
+		ExpiresAt:   s.refreshTokenExpiry(),
+		LastSeenAt:  time.Now(),
+	}
+
+	tokenDetails, err := s.generateToken(user, &session)
+	if err != nil {
+		return nil, err
+	}
+	session.CurrentTokenID = tokenDetails.TokenID
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		return tx.Create(s.newRefreshToken(&session, tokenDetails)).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to create session")
+		return nil, errors.New("failed to create session")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"session_id": session.ID,
+	}).Info("Session created")
+
+	return tokenDetails, nil
+}
+
+// RefreshTokens rotates a refresh token, returning a new JWT and refresh token for the same session.
+// Presenting a token that has already been rotated revokes the whole session.
+func (s *AuthService) RefreshTokens(rawToken string, device *models.DeviceInfo) (*models.TokenDetails, *models.User, error) {
+	var stored models.RefreshToken
+	result := s.db.Where("token_hash = ?", utils.HashToken(rawToken)).First(&stored)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		s.logger.WithError(result.Error).Error("Failed to query refresh token")
+		return nil, nil, errors.New("failed to query refresh token")
+	}
+
+	if stored.RevokedAt != nil {
+		s.handleRefreshTokenReuse(&stored)
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	var session models.Session
+	if err := s.db.Where("id = ? AND revoked_at IS NULL", stored.SessionID).First(&session).Error; err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	if session.DeviceID != "" && session.DeviceID != device.DeviceID {
 		s.logger.WithFields(logrus.Fields{
-			"user_id": user.ID,
-			"email":   user.Email,
-		}).Info("Existing user updated")
+			"user_id":    stored.UserID,
+			"session_id": session.ID,
+		}).Warn("Refresh token presented from a different device")
+		return nil, nil, ErrInvalidRefreshToken
 	}
 
-	// Generate JWT token
-	tokenDetails, err := utils.GenerateToken(user.ID, user.Email, user.Name, s.config.JWTSecret, s.config.JWTExpirationMinutes)
+	var user models.User
+	if err := s.db.Where("id = ?", stored.UserID).First(&user).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get user for refresh token")
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	tokenDetails, err := s.generateToken(&user, &session)
 	if err != nil {
-		s.logger.WithError(err).Error("Failed to generate JWT token")
 		return nil, nil, err
 	}
 
+	replacement := s.newRefreshToken(&session, tokenDetails)
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Only rotate if nobody else rotated this token concurrently
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", stored.ID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by_id": replacement.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		if err := tx.Create(replacement).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"current_token_id": tokenDetails.TokenID,
+			"expires_at":       replacement.ExpiresAt,
+			"ip_address":       device.IPAddress,
+			"last_seen_at":     time.Now(),
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			s.handleRefreshTokenReuse(&stored)
+			return nil, nil, ErrRefreshTokenReused
+		}
+		s.logger.WithError(err).Error("Failed to rotate refresh token")
+		return nil, nil, errors.New("failed to rotate refresh token")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    user.ID,
+		"session_id": session.ID,
+	}).Info("Refresh token rotated")
+
 	return tokenDetails, &user, nil
 }
 
-// getUserInfo gets user information from Microsoft Graph API
-func (s *AuthService) getUserInfo(accessToken string) (map[string]interface{}, error) {
-	// Create request
-	req, err := http.NewRequest("GET", "https://graph.microsoft.com/v1.0/me", nil)
+// generateToken issues a JWT for the user bound to the session
+func (s *AuthService) generateToken(user *models.User, session *models.Session) (*models.TokenDetails, error) {
+	tokenDetails, err := utils.GenerateToken(utils.TokenParams{
+		UserID:    user.ID,
+		Email:     user.Email,
+		Name:      user.Name,
+		Role:      string(user.Role),
+		Scopes:    user.Role.DefaultScopes(),
+		SessionID: session.ID,
+		AMR:       session.AMR(),
+		AuthTime:  session.AuthTime,
+	}, s.keys, s.config.JWTExpirationMinutes)
 	if err != nil {
+		s.logger.WithError(err).Error("Failed to generate JWT token")
 		return nil, err
 	}
 
-	// Add authorization header
-	req.Header.Add("Authorization", "Bearer "+accessToken)
+	return tokenDetails, nil
+}
+
+// StepUpSession records that the user of a session has just completed a second factor and
+// issues a new JWT and refresh token carrying it. The session's earlier refresh tokens are retired.
+func (s *AuthService) StepUpSession(user *models.User, sessionID string, authMethods []string) (*models.TokenDetails, error) {
+	var session models.Session
+	result := s.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, user.ID).First(&session)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		s.logger.WithError(result.Error).Error("Failed to get session")
+		return nil, errors.New("failed to get session")
+	}
+
+	// Add the new methods to those of the primary login
+	methods := session.AMR()
+	for _, method := range authMethods {
+		if !slices.Contains(methods, method) {
+			methods = append(methods, method)
+		}
+	}
+	session.AuthMethods = strings.Join(methods, " ")
+	session.AuthTime = time.Now()
 
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	tokenDetails, err := s.generateToken(user, &session)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Check response
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("failed to get user info: " + resp.Status)
+	replacement := s.newRefreshToken(&session, tokenDetails)
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.RefreshToken{}).
+			Where("session_id = ? AND revoked_at IS NULL", session.ID).
+			Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by_id": replacement.ID}).Error
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(replacement).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&session).Updates(map[string]interface{}{
+			"current_token_id": tokenDetails.TokenID,
+			"auth_methods":     session.AuthMethods,
+			"auth_time":        session.AuthTime,
+			"expires_at":       replacement.ExpiresAt,
+			"last_seen_at":     time.Now(),
+		}).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to step up session")
+		return nil, errors.New("failed to step up session")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":      user.ID,
+		"session_id":   session.ID,
+		"auth_methods": session.AuthMethods,
+	}).Info("Session stepped up")
+
+	return tokenDetails, nil
+}
+
+// refreshTokenExpiry returns the expiry of a refresh token issued now
+func (s *AuthService) refreshTokenExpiry() time.Time {
+	return time.Now().Add(time.Hour * 24 * time.Duration(s.config.RefreshTokenTTLDays))
+}
+
+// newRefreshToken builds a refresh token record that stores only the hash of the raw token
+func (s *AuthService) newRefreshToken(session *models.Session, tokenDetails *models.TokenDetails) *models.RefreshToken {
+	return &models.RefreshToken{
+		ID:                   uuid.New().String(),
+		UserID:               session.UserID,
+		SessionID:            session.ID,
+		TokenHash:            utils.HashToken(tokenDetails.RefreshToken),
+		ExpiresAt:            s.refreshTokenExpiry(),
+		AccessTokenID:        tokenDetails.TokenID,
+		AccessTokenExpiresAt: tokenDetails.ExpiresAt,
+	}
+}
+
+// handleRefreshTokenReuse revokes the session of a replayed refresh token
+func (s *AuthService) handleRefreshTokenReuse(token *models.RefreshToken) {
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    token.UserID,
+		"session_id": token.SessionID,
+	}).Warn("Refresh token reuse detected, revoking session")
+
+	if err := s.revokeSessions(s.db.Where("id = ?", token.SessionID)); err != nil {
+		s.logger.WithError(err).Error("Failed to revoke session")
+	}
+}
+
+// ListSessions returns the active sessions of a user, flagging the one identified by currentSessionID
+func (s *AuthService) ListSessions(userID string, currentSessionID string) ([]models.Session, error) {
+	var sessions []models.Session
+
+	result := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to get sessions")
+		return nil, errors.New("failed to get sessions")
 	}
 
-	// Parse response
-	var userInfo map[string]interface{}
-	err = json.NewDecoder(resp.Body).Decode(&userInfo)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentSessionID
+	}
+
+	return sessions, nil
+}
+
+// TouchSession records activity on a session, at most once a minute
+func (s *AuthService) TouchSession(sessionID string) {
+	now := time.Now()
+	err := s.db.Model(&models.Session{}).
+		Where("id = ? AND last_seen_at < ?", sessionID, now.Add(-time.Minute)).
+		Update("last_seen_at", now).Error
 	if err != nil {
-		return nil, err
+		s.logger.WithError(err).Warn("Failed to update session last seen time")
 	}
+}
+
+// RevokeSession revokes a session of the user along with its access and refresh tokens
+func (s *AuthService) RevokeSession(userID string, sessionID string) error {
+	var session models.Session
+	result := s.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).First(&session)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		s.logger.WithError(result.Error).Error("Failed to get session")
+		return errors.New("failed to get session")
+	}
+
+	if err := s.revokeSessions(s.db.Where("id = ?", session.ID)); err != nil {
+		s.logger.WithError(err).Error("Failed to revoke session")
+		return errors.New("failed to revoke session")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    userID,
+		"session_id": sessionID,
+	}).Info("Session revoked")
 
-	return userInfo, nil
+	return nil
+}
+
+// RevokeAllUserTokens revokes every session, and with them every access and refresh token, of a user
+func (s *AuthService) RevokeAllUserTokens(userID string) error {
+	if err := s.revokeSessions(s.db.Where("user_id = ?", userID)); err != nil {
+		s.logger.WithError(err).Error("Failed to revoke user tokens")
+		return errors.New("failed to revoke user tokens")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+	}).Info("All user sessions revoked")
+
+	return nil
+}
+
+// revokeSessions revokes the sessions matched by query, their refresh tokens and the
+// still-valid access tokens that were issued from them
+func (s *AuthService) revokeSessions(query *gorm.DB) error {
+	var sessionIDs []string
+	err := query.Session(&gorm.Session{}).
+		Model(&models.Session{}).
+		Where("revoked_at IS NULL").
+		Pluck("id", &sessionIDs).Error
+	if err != nil {
+		return err
+	}
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	var tokens []models.RefreshToken
+	err = s.db.Where("session_id IN ? AND access_token_expires_at > ?", sessionIDs, time.Now()).
+		Find(&tokens).Error
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if err := s.revocations.Revoke(token.AccessTokenID, token.UserID, token.AccessTokenExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		err := tx.Model(&models.RefreshToken{}).
+			Where("session_id IN ? AND revoked_at IS NULL", sessionIDs).
+			Update("revoked_at", now).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.Session{}).
+			Where("id IN ?", sessionIDs).
+			Update("revoked_at", now).Error
+	})
+}
+
+// JWKS returns the public keys tokens are signed with
+func (s *AuthService) JWKS() (utils.JSONWebKeySet, error) {
+	return s.keys.JWKS()
 }
 
 // ValidateToken validates a JWT token
 func (s *AuthService) ValidateToken(tokenString string) (map[string]interface{}, error) {
-	claims, err := utils.ValidateToken(tokenString, s.config.JWTSecret)
+	claims, err := utils.ValidateToken(tokenString, s.keys)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reject tokens revoked by sign-out or session termination
+	revoked, err := s.revocations.IsRevoked(claims["jti"].(string))
 	if err != nil {
+		s.logger.WithError(err).Error("Failed to check token revocation")
 		return nil, err
 	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
 
 	// Convert claims to map
 	result := make(map[string]interface{})
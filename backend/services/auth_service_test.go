@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newMockAuthService returns an AuthService on a mocked MySQL connection and an in-memory
+// revocation store
+func newMockAuthService(t *testing.T) (*AuthService, sqlmock.Sqlmock, *MemoryRevocationStore) {
+	t.Helper()
+
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: conn, SkipInitializeWithVersion: true}), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("failed to open gorm on sqlmock: %v", err)
+	}
+
+	revocations := NewMemoryRevocationStore()
+	service := &AuthService{
+		config:      &config.Config{},
+		logger:      utils.GetLogger(),
+		db:          db,
+		revocations: revocations,
+	}
+	return service, mock, revocations
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	service, mock, revocations := newMockAuthService(t)
+
+	now := time.Now()
+	rotatedAt := now.Add(-time.Minute)
+	refreshTokenColumns := []string{"id", "user_id", "session_id", "token_hash", "expires_at", "access_token_id", "access_token_expires_at", "revoked_at", "replaced_by_id", "created_at"}
+
+	// The presented token was already rotated into rt-2
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `refresh_tokens` WHERE token_hash = ?")).
+		WithArgs(utils.HashToken("stolen-token"), 1).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow("rt-1", "user-1", "session-1", utils.HashToken("stolen-token"), now.Add(time.Hour), "jti-1", now.Add(10*time.Minute), rotatedAt, "rt-2", rotatedAt))
+
+	// Its session is revoked along with every access token still valid in the family
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT `id` FROM `sessions` WHERE id = ? AND revoked_at IS NULL")).
+		WithArgs("session-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("session-1"))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT * FROM `refresh_tokens` WHERE session_id IN (?) AND access_token_expires_at > ?")).
+		WithArgs("session-1", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(refreshTokenColumns).
+			AddRow("rt-1", "user-1", "session-1", "hash-1", now.Add(time.Hour), "jti-1", now.Add(10*time.Minute), rotatedAt, "rt-2", rotatedAt).
+			AddRow("rt-2", "user-1", "session-1", "hash-2", now.Add(time.Hour), "jti-2", now.Add(15*time.Minute), nil, "", rotatedAt))
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `refresh_tokens` SET `revoked_at`=? WHERE session_id IN (?) AND revoked_at IS NULL")).
+		WithArgs(sqlmock.AnyArg(), "session-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE `sessions` SET `revoked_at`=? WHERE id IN (?)")).
+		WithArgs(sqlmock.AnyArg(), "session-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	_, _, err := service.RefreshTokens("stolen-token", &models.DeviceInfo{})
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("expected ErrRefreshTokenReused, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("session was not revoked: %v", err)
+	}
+
+	// Access tokens issued in the session must stop working before they expire
+	for _, jti := range []string{"jti-1", "jti-2"} {
+		revoked, err := revocations.IsRevoked(jti)
+		if err != nil {
+			t.Fatalf("IsRevoked returned error: %v", err)
+		}
+		if !revoked {
+			t.Errorf("access token %s was not revoked", jti)
+		}
+	}
+}
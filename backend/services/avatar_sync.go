@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"time"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// avatarExtensions maps the accepted profile photo content types to file extensions
+var avatarExtensions = map[string]string{
+	"image/jpeg":  ".jpg",
+	"image/pjpeg": ".jpg",
+	"image/png":   ".png",
+	"image/gif":   ".gif",
+	"image/webp":  ".webp",
+}
+
+// syncAvatar copies the user's profile photo from the provider into the blob store. The photo is
+// only downloaded when its ETag changed since the last sync. Failures are logged and never block
+// the login.
+func (s *AuthService) syncAvatar(photos PhotoProvider, profile *ExternalProfile, user *models.User) {
+	logger := s.logger.WithFields(logrus.Fields{
+		"user_id":  user.ID,
+		"provider": profile.Provider,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	photo, err := photos.FetchPhoto(ctx, profile.AccessToken, user.AvatarETag)
+	if err != nil {
+		if errors.Is(err, ErrNoPhoto) {
+			s.removeAvatar(user)
+			return
+		}
+		logger.WithError(err).Warn("Failed to fetch profile photo")
+		return
+	}
+	if photo == nil {
+		// Unchanged since the last sync
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(photo.ContentType)
+	extension, ok := avatarExtensions[mediaType]
+	if !ok {
+		logger.WithField("content_type", photo.ContentType).Warn("Unsupported profile photo type")
+		return
+	}
+
+	// A new key per photo lets clients cache avatar URLs indefinitely
+	key := fmt.Sprintf("avatars/%s/%s%s", user.ID, utils.HashToken(photo.ETag)[:16], extension)
+	avatarURL, err := s.blobs.Put(key, photo.ContentType, photo.Data)
+	if err != nil {
+		logger.WithError(err).Error("Failed to store avatar")
+		return
+	}
+
+	previousKey := user.AvatarKey
+	err = s.db.Model(user).Updates(map[string]interface{}{
+		"avatar_url":  avatarURL,
+		"avatar_key":  key,
+		"avatar_etag": photo.ETag,
+	}).Error
+	if err != nil {
+		logger.WithError(err).Error("Failed to update avatar")
+		return
+	}
+	user.AvatarURL = avatarURL
+	user.AvatarKey = key
+	user.AvatarETag = photo.ETag
+
+	if previousKey != "" && previousKey != key {
+		if err := s.blobs.Delete(previousKey); err != nil {
+			logger.WithError(err).Warn("Failed to delete previous avatar")
+		}
+	}
+
+	logger.Info("Avatar updated from profile photo")
+}
+
+// removeAvatar clears the synced avatar of a user whose provider photo was removed
+func (s *AuthService) removeAvatar(user *models.User) {
+	if user.AvatarKey == "" {
+		return
+	}
+
+	err := s.db.Model(user).Updates(map[string]interface{}{
+		"avatar_url":  "",
+		"avatar_key":  "",
+		"avatar_etag": "",
+	}).Error
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to clear avatar")
+		return
+	}
+
+	if err := s.blobs.Delete(user.AvatarKey); err != nil {
+		s.logger.WithError(err).Warn("Failed to delete avatar")
+	}
+
+	user.AvatarURL = ""
+	user.AvatarKey = ""
+	user.AvatarETag = ""
+}
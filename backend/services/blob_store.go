@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-azure/config"
+)
+
+// ErrInvalidBlobKey is returned when a blob key is empty or escapes the store
+var ErrInvalidBlobKey = errors.New("invalid blob key")
+
+// BlobStore stores files, such as avatars, that are served to clients
+type BlobStore interface {
+	// Put stores data under key, replacing any existing blob, and returns its public URL
+	Put(key string, contentType string, data []byte) (string, error)
+	// Delete removes the blob stored under key. Deleting a missing blob is not an error.
+	Delete(key string) error
+}
+
+// NewBlobStore creates the blob store selected by BLOB_STORE_DRIVER
+func NewBlobStore(cfg *config.Config) (BlobStore, error) {
+	switch cfg.BlobStoreDriver {
+	case "local":
+		return NewLocalBlobStore(cfg.BlobStoreDir, strings.TrimSuffix(cfg.PublicURL, "/")+LocalBlobPath), nil
+	default:
+		return nil, fmt.Errorf("unknown blob store driver: %q", cfg.BlobStoreDriver)
+	}
+}
+
+// LocalBlobPath is the route the API serves LocalBlobStore files under
+const LocalBlobPath = "/blobs"
+
+// LocalBlobStore is a BlobStore on the local filesystem. Its files are served by the API
+// under LocalBlobPath, so it suits single-instance deployments and development.
+type LocalBlobStore struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocalBlobStore creates a new LocalBlobStore writing to dir, whose files are served at baseURL
+func NewLocalBlobStore(dir string, baseURL string) *LocalBlobStore {
+	return &LocalBlobStore{
+		dir:     dir,
+		baseURL: baseURL,
+	}
+}
+
+// Put stores data under key and returns its public URL. The file is written to a
+// temporary file first, so readers never see a partially written blob.
+func (s *LocalBlobStore) Put(key string, contentType string, data []byte) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return s.baseURL + "/" + key, nil
+}
+
+// Delete removes the blob stored under key
+func (s *LocalBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path returns the file path of a key, rejecting keys that would escape the store directory
+func (s *LocalBlobStore) path(key string) (string, error) {
+	if key == "" || !filepath.IsLocal(key) {
+		return "", ErrInvalidBlobKey
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"testing"
+
+	"go-azure/config"
+)
+
+func TestNewBlobStoreRejectsUnknownDriver(t *testing.T) {
+	if _, err := NewBlobStore(&config.Config{BlobStoreDriver: "s3"}); err == nil {
+		t.Fatal("expected an error for an unknown blob store driver")
+	}
+
+	store, err := NewBlobStore(&config.Config{BlobStoreDriver: "local", BlobStoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewBlobStore returned error: %v", err)
+	}
+	if _, ok := store.(*LocalBlobStore); !ok {
+		t.Fatalf("expected a LocalBlobStore, got %T", store)
+	}
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrCommentNotFound is returned when a comment does not exist on the post
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrCommentForbidden is returned when a user may not edit or delete a comment
+	ErrCommentForbidden = errors.New("not allowed to modify this comment")
+)
+
+// CommentService handles comments on posts. Comments inherit the visibility of their
+// post: whoever cannot see a post cannot see or add its comments.
+type CommentService struct {
+	db          *gorm.DB
+	logger      *logrus.Logger
+	postService *PostService
+}
+
+// NewCommentService creates a new CommentService
+func NewCommentService(postService *PostService) *CommentService {
+	return &CommentService{
+		db:          utils.GetDB(),
+		logger:      utils.GetLogger(),
+		postService: postService,
+	}
+}
+
+// ListComments returns a page of the comments on a post, newest first, with their authors.
+// Anonymous visitors have an empty viewerID.
+func (s *CommentService) ListComments(postID string, viewerID string, page PageRequest) (*models.Page[*models.Comment], error) {
+	if _, err := s.postService.GetPostByID(postID, viewerID); err != nil {
+		return nil, err
+	}
+
+	pageScope, err := paginate("comments", page)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := s.db.Model(&models.Comment{}).Where("post_id = ?", postID).Count(&total).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count comments")
+		return nil, errors.New("failed to get comments")
+	}
+
+	var comments []*models.Comment
+	if err := s.db.Preload("Author").Where("comments.post_id = ?", postID).Scopes(pageScope).Find(&comments).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get comments")
+		return nil, errors.New("failed to get comments")
+	}
+
+	return newPage(comments, total, page, func(comment *models.Comment) (time.Time, string) {
+		return comment.CreatedAt, comment.ID
+	}), nil
+}
+
+// CreateComment adds a comment to a post the user can see
+func (s *CommentService) CreateComment(postID string, userID string, content string) (*models.Comment, error) {
+	if _, err := s.postService.GetPostByID(postID, userID); err != nil {
+		return nil, err
+	}
+
+	comment := models.Comment{
+		ID:      uuid.New().String(),
+		PostID:  postID,
+		UserID:  userID,
+		Content: content,
+	}
+
+	// Create the comment and count it on the post together
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(&comment).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Post{}).Where("id = ?", postID).
+			UpdateColumn("comments_count", gorm.Expr("comments_count + 1")).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to create comment")
+		return nil, errors.New("failed to create comment")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"comment_id": comment.ID,
+		"post_id":    postID,
+		"user_id":    userID,
+	}).Info("Comment created")
+
+	return &comment, nil
+}
+
+// UpdateComment changes the content of a comment. Only its author may edit it.
+func (s *CommentService) UpdateComment(postID string, commentID string, userID string, content string) (*models.Comment, error) {
+	comment, err := s.getComment(postID, commentID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.UserID != userID {
+		return nil, ErrCommentForbidden
+	}
+
+	if err := s.db.Model(comment).Update("content", content).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to update comment")
+		return nil, errors.New("failed to update comment")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"comment_id": commentID,
+		"user_id":    userID,
+	}).Info("Comment updated")
+
+	return comment, nil
+}
+
+// DeleteComment removes a comment. Its author and the owner of the post may delete it,
+// as may users allowed to moderate content.
+func (s *CommentService) DeleteComment(postID string, commentID string, userID string, canModerate bool) error {
+	comment, err := s.getComment(postID, commentID, userID)
+	if err != nil {
+		return err
+	}
+
+	if comment.UserID != userID && !canModerate {
+		var post models.Post
+		if err := s.db.Select("user_id").Where("id = ?", postID).First(&post).Error; err != nil {
+			s.logger.WithError(err).Error("Failed to get post of comment")
+			return errors.New("failed to delete comment")
+		}
+		if post.UserID != userID {
+			return ErrCommentForbidden
+		}
+	}
+
+	// Delete the comment and uncount it together; only the request that actually
+	// deletes the comment decrements the count
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(comment)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Model(&models.Post{}).Where("id = ? AND comments_count > 0", postID).
+			UpdateColumn("comments_count", gorm.Expr("comments_count - 1")).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to delete comment")
+		return errors.New("failed to delete comment")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"comment_id": commentID,
+		"post_id":    postID,
+		"user_id":    userID,
+	}).Info("Comment deleted")
+
+	return nil
+}
+
+// getComment returns a comment on a post the user can see
+func (s *CommentService) getComment(postID string, commentID string, userID string) (*models.Comment, error) {
+	if _, err := s.postService.GetPostByID(postID, userID); err != nil {
+		return nil, err
+	}
+
+	var comment models.Comment
+	result := s.db.Where("id = ? AND post_id = ?", commentID, postID).First(&comment)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		s.logger.WithError(result.Error).Error("Failed to get comment")
+		return nil, errors.New("failed to get comment")
+	}
+
+	return &comment, nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"go-azure/config"
+)
+
+var (
+	// ErrUnknownProvider is returned when no identity provider is registered under the requested name
+	ErrUnknownProvider = errors.New("unknown identity provider")
+	// ErrNoPhoto is returned by a PhotoProvider when the user has no profile photo
+	ErrNoPhoto = errors.New("user has no profile photo")
+)
+
+// ExternalProfile is the normalized identity returned by an IdentityProvider. Email is
+// lowercased; EmailVerified is only set when the provider vouches that the user controls it.
+type ExternalProfile struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	TenantID      string
+	AccessToken   string
+}
+
+// IdentityProvider is an external OAuth2/OIDC provider users can sign in with
+type IdentityProvider interface {
+	// Name returns the provider name used in the /auth/:provider routes
+	Name() string
+	// LoginURL returns the authorization URL with the state, nonce and an S256 PKCE challenge for codeVerifier
+	LoginURL(ctx context.Context, state string, codeVerifier string, nonce string) (string, error)
+	// Exchange trades an authorization code for the user's normalized profile, checking the nonce
+	Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*ExternalProfile, error)
+}
+
+// ProfilePhoto is a user's profile picture as returned by a PhotoProvider
+type ProfilePhoto struct {
+	Data        []byte
+	ContentType string
+	ETag        string
+}
+
+// PhotoProvider is implemented by identity providers that can return the user's profile picture
+type PhotoProvider interface {
+	// FetchPhoto returns the photo of the user the access token belongs to. It returns a nil
+	// photo when etag is non-empty and the photo has not changed, and ErrNoPhoto when the
+	// user has no photo.
+	FetchPhoto(ctx context.Context, accessToken string, etag string) (*ProfilePhoto, error)
+}
+
+// NewIdentityProviders creates the identity providers enabled in the configuration, keyed by name
+func NewIdentityProviders(cfg *config.Config) map[string]IdentityProvider {
+	providers := make(map[string]IdentityProvider)
+
+	if cfg.MicrosoftClientID != "" {
+		microsoft := NewMicrosoftProvider(cfg)
+		providers[microsoft.Name()] = microsoft
+	}
+
+	for _, providerConfig := range cfg.OIDCProviders {
+		oidc := NewOIDCProvider(providerConfig)
+		providers[oidc.Name()] = oidc
+	}
+
+	return providers
+}
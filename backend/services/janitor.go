@@ -0,0 +1,28 @@
+package services
+
+import (
+	"time"
+
+	"go-azure/utils"
+)
+
+// StartJanitor periodically runs purge in the background to remove expired records.
+// An interval of zero or less disables the janitor.
+func StartJanitor(name string, interval time.Duration, purge func() error) {
+	logger := utils.GetLogger()
+	if interval <= 0 {
+		logger.WithField("janitor", name).Warn("Purging of expired records is disabled")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := purge(); err != nil {
+				logger.WithError(err).WithField("janitor", name).Error("Failed to purge expired records")
+			}
+		}
+	}()
+}
@@ -0,0 +1,428 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidCredentials is returned when an email and password do not match a local user
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrInvalidResetToken is returned when a password reset token is unknown, expired or already used
+	ErrInvalidResetToken = errors.New("invalid password reset token")
+	// ErrInvalidVerificationToken is returned when an email verification token is unknown, expired or already used
+	ErrInvalidVerificationToken = errors.New("invalid email verification token")
+	// ErrVerificationRequired is returned when a local user signs in before verifying their email
+	ErrVerificationRequired = errors.New("email address has not been verified")
+)
+
+// LocalAuthService handles username/password authentication for deployments without an identity provider
+type LocalAuthService struct {
+	config       *config.Config
+	logger       *logrus.Logger
+	db           *gorm.DB
+	authService  *AuthService
+	mailer       Mailer
+	rateLimits   RateLimitStore
+	backoff      BackoffPolicy
+	accountLimit RateLimit
+	// dummyHash is verified against when the user does not exist, so unknown
+	// emails take as long to reject as wrong passwords
+	dummyHash string
+}
+
+// NewLocalAuthService creates a new LocalAuthService
+func NewLocalAuthService(config *config.Config, authService *AuthService, mailer Mailer, rateLimits RateLimitStore) *LocalAuthService {
+	dummyHash, err := utils.HashPassword(uuid.New().String())
+	if err != nil {
+		utils.GetLogger().WithError(err).Fatal("Failed to initialize password hashing")
+	}
+
+	return &LocalAuthService{
+		config:       config,
+		logger:       utils.GetLogger(),
+		db:           utils.GetDB(),
+		authService:  authService,
+		mailer:       mailer,
+		rateLimits:   rateLimits,
+		backoff:      NewLoginBackoffPolicy(config),
+		accountLimit: NewAccountRateLimit(config),
+		dummyHash:    dummyHash,
+	}
+}
+
+// Register creates a new local user with an unverified email and emails them a verification
+// link. The user cannot sign in, and is not promoted by ADMIN_EMAILS, until they follow it.
+func (s *LocalAuthService) Register(email string, name string, password string) (*models.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	name = strings.TrimSpace(name)
+
+	// Refuse foreign domains early; the allowlist is enforced once the address is verified
+	if !s.authService.emailDomainAllowed(email) {
+		return nil, ErrDomainNotAllowed
+	}
+	if s.config.InviteOnly {
+		return nil, ErrNotInvited
+	}
+
+	// Check if email or username is already taken
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("email = ? OR name = ?", email, name).Count(&count).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to query user")
+		return nil, errors.New("failed to query user")
+	}
+	if count > 0 {
+		return nil, ErrUserExists
+	}
+
+	passwordHash, err := utils.HashPassword(password)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to hash password")
+		return nil, errors.New("failed to hash password")
+	}
+
+	user := models.User{
+		ID:           uuid.New().String(),
+		Email:        email,
+		Name:         name,
+		Role:         models.RoleUser,
+		PasswordHash: passwordHash,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	// Save user to database together with its local identity
+	identity := newUserIdentity(user.ID, models.IdentityProviderLocal, user.ID, user.Email)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to create user")
+		return nil, errors.New("failed to create user")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+		"email":   user.Email,
+	}).Info("New local user registered")
+
+	if err := s.sendVerification(&user); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// sendVerification emails a verification link to a local user
+func (s *LocalAuthService) sendVerification(user *models.User) error {
+	token, err := s.authService.GenerateState()
+	if err != nil {
+		return err
+	}
+
+	verificationToken := models.EmailVerificationToken{
+		TokenHash: utils.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Minute * time.Duration(s.config.EmailVerificationTTLMinutes)),
+	}
+	if err := s.db.Create(&verificationToken).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to store email verification token")
+		return errors.New("failed to store email verification token")
+	}
+
+	verifyURL := fmt.Sprintf("%s/verify-email?token=%s", s.config.AppURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Hi %s,\n\nUse the link below to verify your email address. It expires in %d minutes.\n\n%s\n\nIf you did not create an account, you can ignore this email.\n",
+		user.Name, s.config.EmailVerificationTTLMinutes, verifyURL)
+
+	if err := s.mailer.Send(user.Email, "Verify your email address", body); err != nil {
+		s.logger.WithError(err).WithField("user_id", user.ID).Error("Failed to send verification email")
+		return errors.New("failed to send verification email")
+	}
+
+	return nil
+}
+
+// ResendVerification emails a new verification link to the unverified local user with the
+// given email. It succeeds silently otherwise so the endpoint cannot be used to discover accounts.
+func (s *LocalAuthService) ResendVerification(email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if s.accountEmailThrottled(email) {
+		return nil
+	}
+
+	var user models.User
+	result := s.db.Where("email = ? AND password_hash <> '' AND email_verified = ?", email, false).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		s.logger.WithError(result.Error).Error("Failed to query user")
+		return errors.New("failed to query user")
+	}
+
+	return s.sendVerification(&user)
+}
+
+// VerifyEmail consumes an email verification token and marks the user's email as verified.
+// Only now does the account count as belonging to its email domain and ADMIN_EMAILS apply.
+func (s *LocalAuthService) VerifyEmail(token string) (*models.User, error) {
+	var verificationToken models.EmailVerificationToken
+	result := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&verificationToken)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidVerificationToken
+		}
+		s.logger.WithError(result.Error).Error("Failed to query email verification token")
+		return nil, errors.New("failed to query email verification token")
+	}
+
+	// Deleting the row is what consumes the token; a concurrent verification loses the race
+	result = s.db.Where("token_hash = ?", verificationToken.TokenHash).Delete(&models.EmailVerificationToken{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to consume email verification token")
+		return nil, errors.New("failed to consume email verification token")
+	}
+	if result.RowsAffected == 0 || time.Now().After(verificationToken.ExpiresAt) {
+		return nil, ErrInvalidVerificationToken
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", verificationToken.UserID).First(&user).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get user for email verification")
+		return nil, ErrInvalidVerificationToken
+	}
+
+	user.EmailVerified = true
+	user.UpdatedAt = time.Now()
+	s.authService.applyAdminBootstrap(&user)
+	if err := s.db.Model(&user).Select("email_verified", "role", "updated_at").Updates(&user).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to mark email as verified")
+		return nil, errors.New("failed to verify email")
+	}
+
+	// Any other outstanding verification links are no longer needed
+	s.db.Where("user_id = ?", user.ID).Delete(&models.EmailVerificationToken{})
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+	}).Info("Email verified")
+
+	if err := s.authService.CheckSignInAllowed("local", "", user.Email, user.EmailVerified); err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// Authenticate checks an email and password and returns the matching local user.
+// Repeated failures lock the email out with exponential backoff, returning a ThrottledError.
+func (s *LocalAuthService) Authenticate(email string, password string) (*models.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	// Refuse to check passwords while the account is locked out
+	lockoutKey := "login:" + email
+	if wait, err := s.rateLimits.BlockedFor(lockoutKey); err != nil {
+		s.logger.WithError(err).Error("Failed to check login lockout")
+	} else if wait > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"email":       email,
+			"retry_after": wait.String(),
+		}).Warn("Login attempt during lockout")
+		return nil, &ThrottledError{RetryAfter: wait}
+	}
+
+	// Spreading attempts over many IPs does not buy more guesses against one account
+	if err := takeAccountToken(s.rateLimits, s.accountLimit, "login:"+email); err != nil {
+		s.logger.WithField("email", email).Warn("Login attempts for account throttled")
+		return nil, err
+	}
+
+	var user models.User
+	result := s.db.Where("email = ?", email).First(&user)
+	if result.Error != nil && !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		s.logger.WithError(result.Error).Error("Failed to query user")
+		return nil, errors.New("failed to query user")
+	}
+
+	// Users created through an identity provider have no password and cannot log in locally
+	passwordHash := user.PasswordHash
+	if passwordHash == "" {
+		passwordHash = s.dummyHash
+	}
+
+	valid, err := utils.VerifyPassword(password, passwordHash)
+	if err != nil {
+		s.logger.WithError(err).WithField("user_id", user.ID).Error("Failed to verify password")
+		return nil, ErrInvalidCredentials
+	}
+	if !valid || user.PasswordHash == "" {
+		s.logger.WithField("email", email).Warn("Failed local login attempt")
+		s.recordFailure(lockoutKey)
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := s.rateLimits.Reset(lockoutKey); err != nil {
+		s.logger.WithError(err).Error("Failed to reset login lockout")
+	}
+
+	if !user.EmailVerified {
+		return nil, ErrVerificationRequired
+	}
+
+	if err := s.authService.CheckSignInAllowed("local", "", user.Email, user.EmailVerified); err != nil {
+		s.logger.WithField("email", email).WithError(err).Warn("Sign-in rejected")
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// accountEmailThrottled reports whether too many verification or password reset emails were
+// requested for the address. Callers drop such requests silently, like those for unknown accounts.
+func (s *LocalAuthService) accountEmailThrottled(email string) bool {
+	if err := takeAccountToken(s.rateLimits, s.accountLimit, "email:"+email); err != nil {
+		s.logger.WithField("email", email).Warn("Account emails throttled")
+		return true
+	}
+	return false
+}
+
+// recordFailure counts a failed login against the lockout key
+func (s *LocalAuthService) recordFailure(lockoutKey string) {
+	lockout, err := s.rateLimits.RecordFailure(lockoutKey, s.backoff)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to record login failure")
+		return
+	}
+	if lockout > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"key":     lockoutKey,
+			"lockout": lockout.String(),
+		}).Warn("Account locked out after repeated failed logins")
+	}
+}
+
+// RequestPasswordReset emails a password reset link to the local user with the given email.
+// It succeeds silently for unknown emails so the endpoint cannot be used to discover accounts.
+func (s *LocalAuthService) RequestPasswordReset(email string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if s.accountEmailThrottled(email) {
+		return nil
+	}
+
+	var user models.User
+	result := s.db.Where("email = ? AND password_hash <> ''", email).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		s.logger.WithError(result.Error).Error("Failed to query user")
+		return errors.New("failed to query user")
+	}
+
+	token, err := s.authService.GenerateState()
+	if err != nil {
+		return err
+	}
+
+	resetToken := models.PasswordResetToken{
+		TokenHash: utils.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Minute * time.Duration(s.config.PasswordResetTTLMinutes)),
+	}
+	if err := s.db.Create(&resetToken).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to store password reset token")
+		return errors.New("failed to store password reset token")
+	}
+
+	resetURL := fmt.Sprintf("%s/reset-password?token=%s", s.config.AppURL, url.QueryEscape(token))
+	body := fmt.Sprintf("Hi %s,\n\nUse the link below to reset your password. It expires in %d minutes.\n\n%s\n\nIf you did not request a password reset, you can ignore this email.\n",
+		user.Name, s.config.PasswordResetTTLMinutes, resetURL)
+
+	if err := s.mailer.Send(user.Email, "Reset your password", body); err != nil {
+		s.logger.WithError(err).WithField("user_id", user.ID).Error("Failed to send password reset email")
+		return errors.New("failed to send password reset email")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+	}).Info("Password reset requested")
+
+	return nil
+}
+
+// ResetPassword consumes a password reset token, sets the new password and signs the user out everywhere
+func (s *LocalAuthService) ResetPassword(token string, password string) error {
+	var resetToken models.PasswordResetToken
+	result := s.db.Where("token_hash = ?", utils.HashToken(token)).First(&resetToken)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return ErrInvalidResetToken
+		}
+		s.logger.WithError(result.Error).Error("Failed to query password reset token")
+		return errors.New("failed to query password reset token")
+	}
+
+	// Deleting the row is what consumes the token; a concurrent reset loses the race
+	result = s.db.Where("token_hash = ?", resetToken.TokenHash).Delete(&models.PasswordResetToken{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to consume password reset token")
+		return errors.New("failed to consume password reset token")
+	}
+	if result.RowsAffected == 0 || time.Now().After(resetToken.ExpiresAt) {
+		return ErrInvalidResetToken
+	}
+
+	passwordHash, err := utils.HashPassword(password)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to hash password")
+		return errors.New("failed to hash password")
+	}
+
+	// Following the emailed link also proves control of the address
+	result = s.db.Model(&models.User{}).Where("id = ?", resetToken.UserID).Updates(map[string]interface{}{
+		"password_hash":  passwordHash,
+		"email_verified": true,
+		"updated_at":     time.Now(),
+	})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to update password")
+		return errors.New("failed to update password")
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidResetToken
+	}
+
+	// Any other outstanding reset links are no longer needed
+	s.db.Where("user_id = ?", resetToken.UserID).Delete(&models.PasswordResetToken{})
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": resetToken.UserID,
+	}).Info("Password reset")
+
+	return s.authService.RevokeAllUserTokens(resetToken.UserID)
+}
+
+// PurgeExpiredResetTokens removes password reset tokens that were never used
+func (s *LocalAuthService) PurgeExpiredResetTokens() error {
+	return s.db.Where("expires_at <= ?", time.Now()).Delete(&models.PasswordResetToken{}).Error
+}
+
+// PurgeExpiredVerificationTokens removes email verification tokens that were never used
+func (s *LocalAuthService) PurgeExpiredVerificationTokens() error {
+	return s.db.Where("expires_at <= ?", time.Now()).Delete(&models.EmailVerificationToken{}).Error
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+
+	"go-azure/config"
+	"go-azure/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Mailer sends plain-text emails
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+// NewMailer creates the mailer selected in the configuration
+func NewMailer(cfg *config.Config) Mailer {
+	if cfg.MailerDriver == "smtp" {
+		return NewSMTPMailer(cfg)
+	}
+	return NewLogMailer()
+}
+
+// LogMailer writes emails to the log instead of sending them. It is meant for development.
+type LogMailer struct {
+	logger *logrus.Logger
+}
+
+// NewLogMailer creates a new LogMailer
+func NewLogMailer() *LogMailer {
+	return &LogMailer{
+		logger: utils.GetLogger(),
+	}
+}
+
+// Send logs the email
+func (m *LogMailer) Send(to string, subject string, body string) error {
+	m.logger.WithFields(logrus.Fields{
+		"to":      to,
+		"subject": subject,
+		"body":    body,
+	}).Info("Email not sent (log mailer)")
+	return nil
+}
+
+// SMTPMailer sends emails through an SMTP server
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates a new SMTPMailer
+func NewSMTPMailer(cfg *config.Config) *SMTPMailer {
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+
+	return &SMTPMailer{
+		addr: cfg.SMTPHost + ":" + cfg.SMTPPort,
+		auth: auth,
+		from: cfg.MailFrom,
+	}
+}
+
+// Send sends the email
+func (m *SMTPMailer) Send(to string, subject string, body string) error {
+	// Reject header injection through the recipient or subject
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	message := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		m.from, to, subject, body)
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(message))
+}
@@ -0,0 +1,454 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes generated at a time
+	recoveryCodeCount = 10
+	// maxMFAChallengeAttempts is the number of wrong codes after which a challenge is discarded
+	maxMFAChallengeAttempts = 5
+)
+
+var (
+	// ErrMFAAlreadyEnabled is returned when enrolling a user who already has TOTP enabled
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrMFANotEnrolled is returned when confirming TOTP before enrollment started
+	ErrMFANotEnrolled = errors.New("two-factor enrollment has not been started")
+	// ErrMFANotEnabled is returned when a second factor is required from a user without TOTP
+	ErrMFANotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrInvalidMFACode is returned when a TOTP or recovery code is wrong or already used
+	ErrInvalidMFACode = errors.New("invalid two-factor code")
+	// ErrInvalidMFAChallenge is returned when an MFA challenge is unknown, expired or exhausted
+	ErrInvalidMFAChallenge = errors.New("invalid or expired two-factor challenge")
+)
+
+// TOTPEnrollment is returned when TOTP enrollment starts. The provisioning URI is meant
+// to be rendered as a QR code; the secret is for manual entry.
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFAService handles TOTP two-factor authentication
+type MFAService struct {
+	config       *config.Config
+	logger       *logrus.Logger
+	db           *gorm.DB
+	authService  *AuthService
+	rateLimits   RateLimitStore
+	backoff      BackoffPolicy
+	accountLimit RateLimit
+}
+
+// NewMFAService creates a new MFAService
+func NewMFAService(config *config.Config, authService *AuthService, rateLimits RateLimitStore) *MFAService {
+	return &MFAService{
+		config:       config,
+		logger:       utils.GetLogger(),
+		db:           utils.GetDB(),
+		authService:  authService,
+		rateLimits:   rateLimits,
+		backoff:      NewLoginBackoffPolicy(config),
+		accountLimit: NewAccountRateLimit(config),
+	}
+}
+
+// SignIn completes a primary login. Users without TOTP get their tokens right away; for users
+// with TOTP an MFA challenge is created instead and its token returned, to be redeemed with
+// CompleteChallenge.
+func (s *MFAService) SignIn(user *models.User, device *models.DeviceInfo, authMethods []string) (*models.TokenDetails, string, error) {
+	if !user.TOTPEnabled {
+		tokenDetails, err := s.authService.IssueTokens(user, device, authMethods)
+		return tokenDetails, "", err
+	}
+
+	challengeToken, err := s.authService.GenerateState()
+	if err != nil {
+		return nil, "", err
+	}
+
+	challenge := models.MFAChallenge{
+		ChallengeHash: utils.HashToken(challengeToken),
+		UserID:        user.ID,
+		AuthMethods:   strings.Join(authMethods, " "),
+		ExpiresAt:     time.Now().Add(time.Minute * time.Duration(s.config.MFAChallengeTTLMinutes)),
+	}
+	if err := s.db.Create(&challenge).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to store MFA challenge")
+		return nil, "", errors.New("failed to store MFA challenge")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+	}).Info("MFA challenge issued")
+
+	return nil, challengeToken, nil
+}
+
+// CompleteChallenge verifies the second factor for an MFA challenge and issues the tokens
+// of the login. The challenge is discarded after too many wrong codes.
+func (s *MFAService) CompleteChallenge(challengeToken string, code string, device *models.DeviceInfo) (*models.TokenDetails, *models.User, error) {
+	var challenge models.MFAChallenge
+	result := s.db.Where("challenge_hash = ?", utils.HashToken(challengeToken)).First(&challenge)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidMFAChallenge
+		}
+		s.logger.WithError(result.Error).Error("Failed to query MFA challenge")
+		return nil, nil, errors.New("failed to query MFA challenge")
+	}
+
+	if time.Now().After(challenge.ExpiresAt) {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", challenge.UserID).First(&user).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get user for MFA challenge")
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	methods, err := s.verifyCode(&user, code)
+	if err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			s.recordFailedAttempt(&challenge)
+		}
+		return nil, nil, err
+	}
+
+	// Deleting the row is what redeems the challenge; a concurrent redemption loses the race
+	result = s.db.Where("challenge_hash = ?", challenge.ChallengeHash).Delete(&models.MFAChallenge{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to redeem MFA challenge")
+		return nil, nil, errors.New("failed to redeem MFA challenge")
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil, ErrInvalidMFAChallenge
+	}
+
+	tokenDetails, err := s.authService.IssueTokens(&user, device, append(strings.Fields(challenge.AuthMethods), methods...))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tokenDetails, &user, nil
+}
+
+// recordFailedAttempt counts a wrong code against a challenge and discards it once exhausted
+func (s *MFAService) recordFailedAttempt(challenge *models.MFAChallenge) {
+	s.logger.WithFields(logrus.Fields{
+		"user_id":  challenge.UserID,
+		"attempts": challenge.Attempts + 1,
+	}).Warn("Invalid MFA code for challenge")
+
+	if challenge.Attempts+1 >= maxMFAChallengeAttempts {
+		s.db.Where("challenge_hash = ?", challenge.ChallengeHash).Delete(&models.MFAChallenge{})
+		return
+	}
+
+	s.db.Model(&models.MFAChallenge{}).
+		Where("challenge_hash = ?", challenge.ChallengeHash).
+		Update("attempts", gorm.Expr("attempts + 1"))
+}
+
+// StepUp verifies a second factor for an existing session and returns new tokens
+// whose amr and auth_time claims show the recent MFA
+func (s *MFAService) StepUp(userID string, sessionID string, code string) (*models.TokenDetails, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	methods, err := s.verifyCode(user, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authService.StepUpSession(user, sessionID, methods)
+}
+
+// verifyCode checks a TOTP code or, failing that, a recovery code, and returns the
+// authentication methods it proves. Both kinds of code are single-use. Repeated wrong
+// codes lock the user out with exponential backoff, returning a ThrottledError.
+func (s *MFAService) verifyCode(user *models.User, code string) ([]string, error) {
+	if !user.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	lockoutKey := "mfa:" + user.ID
+	if wait, err := s.rateLimits.BlockedFor(lockoutKey); err != nil {
+		s.logger.WithError(err).Error("Failed to check MFA lockout")
+	} else if wait > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"user_id":     user.ID,
+			"retry_after": wait.String(),
+		}).Warn("MFA attempt during lockout")
+		return nil, &ThrottledError{RetryAfter: wait}
+	}
+
+	if err := takeAccountToken(s.rateLimits, s.accountLimit, "mfa:"+user.ID); err != nil {
+		s.logger.WithField("user_id", user.ID).Warn("MFA attempts for account throttled")
+		return nil, err
+	}
+
+	methods, err := s.checkCode(user, code)
+	if errors.Is(err, ErrInvalidMFACode) {
+		lockout, recordErr := s.rateLimits.RecordFailure(lockoutKey, s.backoff)
+		if recordErr != nil {
+			s.logger.WithError(recordErr).Error("Failed to record MFA failure")
+		} else if lockout > 0 {
+			s.logger.WithFields(logrus.Fields{
+				"user_id": user.ID,
+				"lockout": lockout.String(),
+			}).Warn("Second factor locked out after repeated wrong codes")
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.rateLimits.Reset(lockoutKey); err != nil {
+		s.logger.WithError(err).Error("Failed to reset MFA lockout")
+	}
+
+	return methods, nil
+}
+
+// checkCode checks a TOTP code or, failing that, a recovery code
+func (s *MFAService) checkCode(user *models.User, code string) ([]string, error) {
+	if step, ok := utils.ValidateTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now()); ok {
+		// Record the step only if no concurrent request used it first, so a code cannot be replayed
+		result := s.db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			s.logger.WithError(result.Error).Error("Failed to record TOTP use")
+			return nil, errors.New("failed to verify code")
+		}
+		if result.RowsAffected == 0 {
+			return nil, ErrInvalidMFACode
+		}
+		return []string{models.AuthMethodOTP, models.AuthMethodMFA}, nil
+	}
+
+	// Try the code as a recovery code
+	result := s.db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to redeem recovery code")
+		return nil, errors.New("failed to verify code")
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidMFACode
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+	}).Warn("Recovery code used")
+
+	return []string{models.AuthMethodMFA}, nil
+}
+
+// Enroll starts TOTP enrollment by generating a new secret for the user. TOTP is not
+// enabled until a code from the authenticator app is confirmed with ConfirmEnrollment.
+func (s *MFAService) Enroll(userID string) (*TOTPEnrollment, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Model(user).Update("totp_secret", secret).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to store TOTP secret")
+		return nil, errors.New("failed to start enrollment")
+	}
+
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(s.config.MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment enables TOTP once the user proves their authenticator app produces
+// valid codes, and returns a fresh set of recovery codes, which are shown only once
+func (s *MFAService) ConfirmEnrollment(userID string, code string) ([]string, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to enable TOTP")
+		return nil, errors.New("failed to enable two-factor authentication")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+	}).Info("TOTP enabled")
+
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes with a new set
+func (s *MFAService) RegenerateRecoveryCodes(userID string) ([]string, error) {
+	user, err := s.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrMFANotEnabled
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		codes, err = s.replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to regenerate recovery codes")
+		return nil, errors.New("failed to regenerate recovery codes")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+	}).Info("Recovery codes regenerated")
+
+	return codes, nil
+}
+
+// Disable turns off TOTP for the user and deletes their recovery codes
+func (s *MFAService) Disable(userID string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to disable TOTP")
+		return errors.New("failed to disable two-factor authentication")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+	}).Info("TOTP disabled")
+
+	return nil
+}
+
+// PurgeExpiredChallenges removes MFA challenges that were never completed
+func (s *MFAService) PurgeExpiredChallenges() error {
+	return s.db.Where("expires_at <= ?", time.Now()).Delete(&models.MFAChallenge{}).Error
+}
+
+// replaceRecoveryCodes deletes the user's recovery codes and stores the hashes of a new set
+func (s *MFAService) replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			ID:       uuid.New().String(),
+			UserID:   userID,
+			CodeHash: utils.HashToken(normalizeRecoveryCode(code)),
+		})
+	}
+
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// getUser returns a user by ID
+func (s *MFAService) getUser(userID string) (*models.User, error) {
+	var user models.User
+	result := s.db.Where("id = ?", userID).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		s.logger.WithError(result.Error).Error("Failed to get user")
+		return nil, errors.New("failed to get user")
+	}
+
+	return &user, nil
+}
+
+// generateRecoveryCode generates a random 50-bit recovery code formatted as xxxxx-xxxxx
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode strips the formatting users may type along with a recovery code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-azure/config"
+	"go-azure/utils"
+
+	"golang.org/x/oauth2"
+)
+
+// maxPhotoSize is the largest profile photo accepted from Microsoft Graph
+const maxPhotoSize = 4 << 20
+
+// MicrosoftProvider signs users in with Microsoft Entra ID. The profile is taken
+// from the validated ID token; only the profile photo comes from Microsoft Graph.
+type MicrosoftProvider struct {
+	clientID     string
+	clientSecret string
+	redirectURI  string
+	graphURL     string
+	tenantID     string
+	trustedTIDs  []string
+	verifier     *OIDCVerifier
+	httpClient   *http.Client
+}
+
+// NewMicrosoftProvider creates a new MicrosoftProvider.
+// Without a client secret the app is treated as a public client and relies on PKCE alone.
+func NewMicrosoftProvider(cfg *config.Config) *MicrosoftProvider {
+	issuer := fmt.Sprintf("%s/%s/v2.0", cfg.MicrosoftAuthority, cfg.MicrosoftTenantID)
+
+	httpClient := &http.Client{Timeout: 10 * time.Second}
+
+	return &MicrosoftProvider{
+		clientID:     cfg.MicrosoftClientID,
+		clientSecret: cfg.MicrosoftClientSecret,
+		redirectURI:  cfg.MicrosoftRedirectURI,
+		graphURL:     strings.TrimSuffix(cfg.MicrosoftGraphURL, "/"),
+		tenantID:     cfg.MicrosoftTenantID,
+		trustedTIDs:  cfg.AllowedTenantIDs,
+		verifier:     NewOIDCVerifier(issuer, cfg.MicrosoftClientID, httpClient),
+		httpClient:   httpClient,
+	}
+}
+
+// Name returns the provider name
+func (p *MicrosoftProvider) Name() string {
+	return "microsoft"
+}
+
+// LoginURL returns the URL for Microsoft login with a nonce and an S256 PKCE challenge
+func (p *MicrosoftProvider) LoginURL(ctx context.Context, state string, codeVerifier string, nonce string) (string, error) {
+	oauth2Config, err := p.oauth2Config(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return oauth2Config.AuthCodeURL(state, oauth2.S256ChallengeOption(codeVerifier), oauth2.SetAuthURLParam("nonce", nonce)), nil
+}
+
+// Exchange trades the authorization code for tokens and validates the returned ID token
+func (p *MicrosoftProvider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*ExternalProfile, error) {
+	oauth2Config, err := p.oauth2Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exchange code for token, proving possession of the PKCE verifier. The oauth2 package
+	// only uses our client, and its timeout, when it is passed through the context.
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.httpClient)
+	token, err := oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in Microsoft token response")
+	}
+
+	claims, err := p.verifier.Verify(ctx, rawIDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// oid is immutable across apps within a tenant, unlike the pairwise sub
+	profile := &ExternalProfile{
+		Provider:    p.Name(),
+		Subject:     claimString(claims, "oid"),
+		Email:       claimString(claims, "preferred_username"),
+		Name:        claimString(claims, "name"),
+		TenantID:    claimString(claims, "tid"),
+		AccessToken: token.AccessToken,
+	}
+
+	// The UPN in preferred_username can only use domains verified by its tenant, so it is
+	// trusted when the tenant is. The optional email claim is never verified by Entra ID.
+	profile.EmailVerified = profile.Email != "" && p.trustsTenant(profile.TenantID)
+	if profile.Email == "" {
+		profile.Email = claimString(claims, "email")
+	}
+	profile.Email = strings.ToLower(strings.TrimSpace(profile.Email))
+	if profile.Subject == "" || profile.Email == "" {
+		return nil, errors.New("incomplete claims in Microsoft id_token")
+	}
+	if profile.Name == "" {
+		profile.Name = profile.Email
+	}
+
+	return profile, nil
+}
+
+// trustsTenant reports whether UPNs of the tenant can be trusted as verified email
+// addresses: the tenant is the single tenant the app is registered for, or is listed in
+// ALLOWED_TENANT_IDS
+func (p *MicrosoftProvider) trustsTenant(tenantID string) bool {
+	if tenantID == "" {
+		return false
+	}
+	switch strings.ToLower(p.tenantID) {
+	case "common", "organizations", "consumers":
+	default:
+		if strings.EqualFold(p.tenantID, tenantID) {
+			return true
+		}
+	}
+	return containsFold(p.trustedTIDs, tenantID)
+}
+
+// FetchPhoto downloads the user's photo from Microsoft Graph. The stored ETag is sent as
+// If-None-Match so an unchanged photo is not downloaded again.
+func (p *MicrosoftProvider) FetchPhoto(ctx context.Context, accessToken string, etag string) (*ProfilePhoto, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.graphURL+"/me/photo/$value", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		return nil, nil
+	case http.StatusNotFound:
+		return nil, ErrNoPhoto
+	default:
+		return nil, fmt.Errorf("unexpected status from Microsoft Graph photo endpoint: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPhotoSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxPhotoSize {
+		return nil, errors.New("profile photo is too large")
+	}
+
+	photo := &ProfilePhoto{
+		Data:        data,
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+	}
+
+	// Some responses carry no ETag; fall back to the content hash
+	if photo.ETag == "" {
+		photo.ETag = fmt.Sprintf(`"%s"`, utils.HashToken(string(data)))
+	}
+
+	// The server may ignore If-None-Match
+	if photo.ETag == etag {
+		return nil, nil
+	}
+
+	return photo, nil
+}
+
+// oauth2Config returns the OAuth2 config for Microsoft using the endpoints from discovery
+func (p *MicrosoftProvider) oauth2Config(ctx context.Context) (*oauth2.Config, error) {
+	discovery, err := p.verifier.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := oauth2.Endpoint{
+		AuthURL:  discovery.AuthorizationEndpoint,
+		TokenURL: discovery.TokenEndpoint,
+	}
+	if p.clientSecret == "" {
+		endpoint.AuthStyle = oauth2.AuthStyleInParams
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.clientID,
+		ClientSecret: p.clientSecret,
+		RedirectURL:  p.redirectURI,
+		Scopes:       []string{"openid", "profile", "email", "offline_access", "User.Read"},
+		Endpoint:     endpoint,
+	}, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-azure/config"
+)
+
+// newGraphStub serves /me/photo/$value like Microsoft Graph, answering If-None-Match
+// with 304 Not Modified while the photo keeps the given ETag
+func newGraphStub(t *testing.T, etag string, photo []byte) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/me/photo/$value" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer graph-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("ETag", etag)
+		w.Write(photo)
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func newTestMicrosoftProvider(graphURL string) *MicrosoftProvider {
+	return NewMicrosoftProvider(&config.Config{
+		MicrosoftAuthority: "https://login.microsoftonline.com",
+		MicrosoftTenantID:  "common",
+		MicrosoftClientID:  "client-id",
+		MicrosoftGraphURL:  graphURL,
+	})
+}
+
+func TestFetchPhotoETagUnchanged(t *testing.T) {
+	server := newGraphStub(t, `"v1"`, []byte("photo"))
+	provider := newTestMicrosoftProvider(server.URL)
+
+	photo, err := provider.FetchPhoto(context.Background(), "graph-token", `"v1"`)
+	if err != nil {
+		t.Fatalf("FetchPhoto returned error: %v", err)
+	}
+	if photo != nil {
+		t.Fatalf("expected no photo for an unchanged ETag, got %+v", photo)
+	}
+}
+
+func TestFetchPhotoETagChanged(t *testing.T) {
+	server := newGraphStub(t, `"v2"`, []byte("new photo"))
+	provider := newTestMicrosoftProvider(server.URL)
+
+	photo, err := provider.FetchPhoto(context.Background(), "graph-token", `"v1"`)
+	if err != nil {
+		t.Fatalf("FetchPhoto returned error: %v", err)
+	}
+	if photo == nil {
+		t.Fatal("expected a photo for a changed ETag")
+	}
+	if !bytes.Equal(photo.Data, []byte("new photo")) {
+		t.Errorf("unexpected photo data %q", photo.Data)
+	}
+	if photo.ContentType != "image/jpeg" {
+		t.Errorf("unexpected content type %q", photo.ContentType)
+	}
+	if photo.ETag != `"v2"` {
+		t.Errorf("unexpected ETag %q", photo.ETag)
+	}
+}
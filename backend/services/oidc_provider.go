@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-azure/config"
+
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider signs users in with a generic OAuth2/OpenID Connect provider such as Google or GitHub.
+// When an issuer is configured, endpoints come from its discovery document and the profile is
+// taken from the validated ID token; otherwise the profile is read from the userinfo endpoint.
+// Claim names are configurable to accommodate plain OAuth2 providers.
+type OIDCProvider struct {
+	config     config.OIDCProviderConfig
+	verifier   *OIDCVerifier
+	httpClient *http.Client
+}
+
+// NewOIDCProvider creates a new OIDCProvider
+func NewOIDCProvider(cfg config.OIDCProviderConfig) *OIDCProvider {
+	provider := &OIDCProvider{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+	if cfg.Issuer != "" {
+		provider.verifier = NewOIDCVerifier(cfg.Issuer, cfg.ClientID, provider.httpClient)
+	}
+	return provider
+}
+
+// Name returns the provider name
+func (p *OIDCProvider) Name() string {
+	return p.config.Name
+}
+
+// LoginURL returns the authorization URL with a nonce and an S256 PKCE challenge
+func (p *OIDCProvider) LoginURL(ctx context.Context, state string, codeVerifier string, nonce string) (string, error) {
+	oauth2Config, _, err := p.oauth2Config(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return oauth2Config.AuthCodeURL(state, oauth2.S256ChallengeOption(codeVerifier), oauth2.SetAuthURLParam("nonce", nonce)), nil
+}
+
+// Exchange trades the authorization code for tokens and resolves the user's profile
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (*ExternalProfile, error) {
+	oauth2Config, userInfoURL, err := p.oauth2Config(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exchange code for token, proving possession of the PKCE verifier. The oauth2 package
+	// only uses our client, and its timeout, when it is passed through the context.
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.httpClient)
+	token, err := oauth2Config.Exchange(ctx, code, oauth2.VerifierOption(codeVerifier))
+	if err != nil {
+		return nil, err
+	}
+
+	// Prefer the signed ID token; fall back to userinfo for plain OAuth2 providers
+	var claims map[string]interface{}
+	if p.verifier != nil {
+		rawIDToken, ok := token.Extra("id_token").(string)
+		if !ok {
+			return nil, fmt.Errorf("no id_token in %s token response", p.config.Name)
+		}
+		claims, err = p.verifier.Verify(ctx, rawIDToken, nonce)
+	} else {
+		claims, err = p.getUserInfo(ctx, userInfoURL, token.AccessToken)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &ExternalProfile{
+		Provider:      p.config.Name,
+		Subject:       claimString(claims, p.config.SubjectClaim),
+		Email:         strings.ToLower(strings.TrimSpace(claimString(claims, p.config.EmailClaim))),
+		EmailVerified: claimBool(claims, p.config.EmailVerifiedClaim),
+		Name:          claimString(claims, p.config.NameClaim),
+		AccessToken:   token.AccessToken,
+	}
+	if profile.Subject == "" || profile.Email == "" {
+		return nil, fmt.Errorf("incomplete user info from %s", p.config.Name)
+	}
+	if profile.Name == "" {
+		profile.Name = profile.Email
+	}
+
+	return profile, nil
+}
+
+// oauth2Config returns the OAuth2 config and userinfo URL, filling unset endpoints from discovery
+func (p *OIDCProvider) oauth2Config(ctx context.Context) (*oauth2.Config, string, error) {
+	authURL, tokenURL, userInfoURL := p.config.AuthURL, p.config.TokenURL, p.config.UserInfoURL
+
+	if p.verifier != nil {
+		discovery, err := p.verifier.Discover(ctx)
+		if err != nil {
+			return nil, "", err
+		}
+		if authURL == "" {
+			authURL = discovery.AuthorizationEndpoint
+		}
+		if tokenURL == "" {
+			tokenURL = discovery.TokenEndpoint
+		}
+		if userInfoURL == "" {
+			userInfoURL = discovery.UserInfoEndpoint
+		}
+	}
+
+	return &oauth2.Config{
+		ClientID:     p.config.ClientID,
+		ClientSecret: p.config.ClientSecret,
+		RedirectURL:  p.config.RedirectURI,
+		Scopes:       p.config.Scopes,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  authURL,
+			TokenURL: tokenURL,
+		},
+	}, userInfoURL, nil
+}
+
+// getUserInfo gets the user's claims from the provider's userinfo endpoint
+func (p *OIDCProvider) getUserInfo(ctx context.Context, userInfoURL string, accessToken string) (map[string]interface{}, error) {
+	// Create request
+	req, err := http.NewRequestWithContext(ctx, "GET", userInfoURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add authorization header
+	req.Header.Add("Authorization", "Bearer "+accessToken)
+	req.Header.Add("Accept", "application/json")
+
+	// Send request
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Check response
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("failed to get user info: " + resp.Status)
+	}
+
+	// Parse response, keeping numeric IDs (e.g. GitHub) exact
+	var claims map[string]interface{}
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// claimString returns a claim as a string, or an empty string if it is missing or not a scalar
+func claimString(claims map[string]interface{}, name string) string {
+	switch value := claims[name].(type) {
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	default:
+		return ""
+	}
+}
+
+// claimBool reads a boolean claim. Some providers send booleans as "true"/"false" strings.
+func claimBool(claims map[string]interface{}, name string) bool {
+	switch value := claims[name].(type) {
+	case bool:
+		return value
+	case string:
+		return strings.EqualFold(value, "true")
+	default:
+		return false
+	}
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-azure/config"
+)
+
+func TestOIDCProviderExchangeTimesOut(t *testing.T) {
+	// A token endpoint that hangs until the test is over
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	provider := NewOIDCProvider(config.OIDCProviderConfig{
+		Name:        "slow",
+		ClientID:    "client-id",
+		AuthURL:     server.URL + "/authorize",
+		TokenURL:    server.URL + "/token",
+		UserInfoURL: server.URL + "/userinfo",
+	})
+	provider.httpClient.Timeout = 100 * time.Millisecond
+
+	start := time.Now()
+	_, err := provider.Exchange(context.Background(), "code", "verifier", "nonce")
+	if err == nil {
+		t.Fatal("expected the exchange to fail against a hung token endpoint")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("exchange took %s, the client timeout was not applied", elapsed)
+	}
+}
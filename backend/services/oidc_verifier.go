@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go-azure/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksCacheTTL is how long fetched signing keys are trusted before they are refreshed
+	jwksCacheTTL = time.Hour
+	// jwksMinRefreshInterval limits refetching when a token references an unknown kid
+	jwksMinRefreshInterval = time.Minute
+)
+
+// ErrInvalidIDToken is returned when an ID token fails signature or claim validation
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// OIDCDiscovery is the subset of an OpenID Provider's discovery document used for sign-in
+type OIDCDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCVerifier validates ID tokens against the keys published by an OpenID Provider.
+// The discovery document and JWKS are fetched lazily, cached, and refreshed when
+// a token is signed with a key that is not in the cache.
+type OIDCVerifier struct {
+	issuer     string
+	clientID   string
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	discovery     *OIDCDiscovery
+	keys          map[string]crypto.PublicKey
+	keysFetchedAt time.Time
+}
+
+// NewOIDCVerifier creates a new OIDCVerifier for the given issuer and client ID
+func NewOIDCVerifier(issuer string, clientID string, httpClient *http.Client) *OIDCVerifier {
+	return &OIDCVerifier{
+		issuer:     strings.TrimSuffix(issuer, "/"),
+		clientID:   clientID,
+		httpClient: httpClient,
+	}
+}
+
+// Discover returns the provider's discovery document, fetching it on first use
+func (v *OIDCVerifier) Discover(ctx context.Context) (*OIDCDiscovery, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	return v.discoverLocked(ctx)
+}
+
+// Verify validates the signature, issuer, audience, expiry and nonce of an ID token and returns its claims
+func (v *OIDCVerifier) Verify(ctx context.Context, rawIDToken string, nonce string) (jwt.MapClaims, error) {
+	discovery, err := v.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithAudience(v.clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithJSONNumber(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	// Multi-tenant issuers (e.g. Microsoft "common") publish a {tenantid} template
+	expectedIssuer := strings.ReplaceAll(discovery.Issuer, "{tenantid}", claimString(claims, "tid"))
+	if claimString(claims, "iss") != expectedIssuer {
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidIDToken)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claimString(claims, "nonce")), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// publicKey returns the cached key for kid, refreshing the JWKS when it is stale or the kid is unknown
+func (v *OIDCVerifier) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	key, ok := v.keys[kid]
+	stale := time.Since(v.keysFetchedAt) > jwksCacheTTL
+	if ok && !stale {
+		return key, nil
+	}
+
+	// Signing keys were rotated (or never fetched); avoid hammering the provider on bogus kids
+	if stale || time.Since(v.keysFetchedAt) > jwksMinRefreshInterval {
+		if err := v.refreshKeysLocked(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	key, ok = v.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// discoverLocked fetches the discovery document if it has not been fetched yet; v.mu must be held
+func (v *OIDCVerifier) discoverLocked(ctx context.Context) (*OIDCDiscovery, error) {
+	if v.discovery != nil {
+		return v.discovery, nil
+	}
+
+	var discovery OIDCDiscovery
+	if err := v.getJSON(ctx, v.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	if discovery.Issuer == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("incomplete discovery document")
+	}
+
+	v.discovery = &discovery
+	return v.discovery, nil
+}
+
+// refreshKeysLocked refetches the provider's JWKS; v.mu must be held
+func (v *OIDCVerifier) refreshKeysLocked(ctx context.Context) error {
+	discovery, err := v.discoverLocked(ctx)
+	if err != nil {
+		return err
+	}
+
+	var keySet utils.JSONWebKeySet
+	if err := v.getJSON(ctx, discovery.JWKSURI, &keySet); err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(keySet.Keys))
+	for _, jwk := range keySet.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.PublicKey()
+		if err != nil {
+			// Skip key types we do not support rather than failing the whole set
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	v.keys = keys
+	v.keysFetchedAt = time.Now()
+	return nil
+}
+
+// getJSON fetches url and decodes the JSON response into out
+func (v *OIDCVerifier) getJSON(ctx context.Context, url string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := v.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("unexpected response: " + resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
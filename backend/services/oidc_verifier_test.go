@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go-azure/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "test-client"
+	testNonce    = "test-nonce"
+)
+
+// testIssuer is an httptest OpenID Provider serving discovery and a JWKS that can be rotated
+type testIssuer struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	keys      map[string]*ecdsa.PrivateKey
+	jwksFetch int
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	issuer := &testIssuer{keys: make(map[string]*ecdsa.PrivateKey)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(OIDCDiscovery{
+			Issuer:                issuer.server.URL,
+			AuthorizationEndpoint: issuer.server.URL + "/authorize",
+			TokenEndpoint:         issuer.server.URL + "/token",
+			JWKSURI:               issuer.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		defer issuer.mu.Unlock()
+
+		issuer.jwksFetch++
+		var keySet utils.JSONWebKeySet
+		for kid, key := range issuer.keys {
+			jwk, err := utils.NewJSONWebKey(kid, "ES256", &key.PublicKey)
+			if err != nil {
+				t.Errorf("failed to encode JWK: %v", err)
+				return
+			}
+			keySet.Keys = append(keySet.Keys, jwk)
+		}
+		json.NewEncoder(w).Encode(keySet)
+	})
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+
+	issuer.addKey(t, "key-1")
+	return issuer
+}
+
+// addKey publishes a new signing key in the JWKS
+func (i *testIssuer) addKey(t *testing.T, kid string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.keys[kid] = key
+}
+
+// jwksFetches returns how often the JWKS was fetched
+func (i *testIssuer) jwksFetches() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.jwksFetch
+}
+
+// claims returns valid ID token claims, which tests then break one at a time
+func (i *testIssuer) claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":   i.server.URL,
+		"aud":   testClientID,
+		"sub":   "subject",
+		"nonce": testNonce,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+}
+
+// sign signs claims with the key kid
+func (i *testIssuer) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	i.mu.Lock()
+	key := i.keys[kid]
+	i.mu.Unlock()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func (i *testIssuer) verifier() *OIDCVerifier {
+	return NewOIDCVerifier(i.server.URL, testClientID, i.server.Client())
+}
+
+func TestOIDCVerifierAcceptsValidToken(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	claims, err := issuer.verifier().Verify(context.Background(), issuer.sign(t, "key-1", issuer.claims()), testNonce)
+	if err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if claimString(claims, "sub") != "subject" {
+		t.Errorf("unexpected subject %q", claimString(claims, "sub"))
+	}
+}
+
+func TestOIDCVerifierRejectsInvalidClaims(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+	}{
+		{"bad audience", func(claims jwt.MapClaims) { claims["aud"] = "other-client" }},
+		{"bad issuer", func(claims jwt.MapClaims) { claims["iss"] = "https://attacker.example.com" }},
+		{"wrong nonce", func(claims jwt.MapClaims) { claims["nonce"] = "other-nonce" }},
+		{"expired", func(claims jwt.MapClaims) {
+			claims["iat"] = time.Now().Add(-2 * time.Hour).Unix()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := issuer.claims()
+			tt.modify(claims)
+
+			_, err := issuer.verifier().Verify(context.Background(), issuer.sign(t, "key-1", claims), testNonce)
+			if !errors.Is(err, ErrInvalidIDToken) {
+				t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOIDCVerifierRefreshesKeysForUnknownKid(t *testing.T) {
+	issuer := newTestIssuer(t)
+	verifier := issuer.verifier()
+
+	if _, err := verifier.Verify(context.Background(), issuer.sign(t, "key-1", issuer.claims()), testNonce); err != nil {
+		t.Fatalf("Verify returned error: %v", err)
+	}
+	if fetches := issuer.jwksFetches(); fetches != 1 {
+		t.Fatalf("expected 1 JWKS fetch, got %d", fetches)
+	}
+
+	// The provider rotates its keys; a token signed with the new key triggers a refresh
+	// once the minimum refresh interval has passed
+	issuer.addKey(t, "key-2")
+	verifier.keysFetchedAt = time.Now().Add(-2 * jwksMinRefreshInterval)
+
+	if _, err := verifier.Verify(context.Background(), issuer.sign(t, "key-2", issuer.claims()), testNonce); err != nil {
+		t.Fatalf("Verify returned error after key rotation: %v", err)
+	}
+	if fetches := issuer.jwksFetches(); fetches != 2 {
+		t.Fatalf("expected 2 JWKS fetches, got %d", fetches)
+	}
+
+	// Within the refresh interval an unknown kid is rejected without refetching
+	issuer.addKey(t, "key-3")
+	_, err := verifier.Verify(context.Background(), issuer.sign(t, "key-3", issuer.claims()), testNonce)
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+	}
+	if fetches := issuer.jwksFetches(); fetches != 2 {
+		t.Fatalf("expected no further JWKS fetch, got %d", fetches)
+	}
+}
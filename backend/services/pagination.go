@@ -0,0 +1,87 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultPageSize is the page size used when a listing does not ask for one
+	DefaultPageSize = 20
+	// MaxPageSize is the largest page size a listing may ask for
+	MaxPageSize = 100
+)
+
+// PageRequest selects a page of a cursor-paginated listing
+type PageRequest struct {
+	Cursor string
+	Limit  int
+}
+
+// number returns the 1-based number of the requested page. Cursors are validated by
+// paginate before a page is built, so an invalid one is never seen here.
+func (p PageRequest) number() int {
+	if p.Cursor == "" {
+		return 1
+	}
+	_, _, number, _ := utils.DecodeCursor(p.Cursor)
+	return number
+}
+
+// paginate orders a query newest first by (created_at, id) of the given table and
+// restricts it to the page after the cursor. One row more than the limit is fetched
+// so newPage can tell whether another page follows.
+func paginate(table string, page PageRequest) (func(db *gorm.DB) *gorm.DB, error) {
+	var (
+		createdAt time.Time
+		id        string
+	)
+	if page.Cursor != "" {
+		var err error
+		if createdAt, id, _, err = utils.DecodeCursor(page.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(db *gorm.DB) *gorm.DB {
+		if page.Cursor != "" {
+			db = db.Where(
+				fmt.Sprintf("%[1]s.created_at < ? OR (%[1]s.created_at = ? AND %[1]s.id < ?)", table),
+				createdAt, createdAt, id,
+			)
+		}
+		return db.
+			Order(fmt.Sprintf("%s.created_at DESC", table)).
+			Order(fmt.Sprintf("%s.id DESC", table)).
+			Limit(page.Limit + 1)
+	}, nil
+}
+
+// newPage builds the page for rows fetched with paginate, using key to build the cursor
+// from the last item
+func newPage[T any](rows []T, total int64, page PageRequest, key func(T) (time.Time, string)) *models.Page[T] {
+	if rows == nil {
+		rows = []T{}
+	}
+
+	result := &models.Page[T]{
+		Items:    rows,
+		Total:    total,
+		Page:     page.number(),
+		PageSize: page.Limit,
+	}
+
+	if len(rows) > page.Limit {
+		result.Items = rows[:page.Limit]
+		result.HasMore = true
+		createdAt, id := key(result.Items[page.Limit-1])
+		result.NextCursor = utils.EncodeCursor(createdAt, id, result.Page+1)
+	}
+
+	return result
+}
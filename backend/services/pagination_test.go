@@ -0,0 +1,193 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// newDryRunDB returns a MySQL gorm.DB that builds statements without connecting
+func newDryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:password@tcp(127.0.0.1:3306)/test?parseTime=true",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatalf("failed to open dry run database: %v", err)
+	}
+	return db
+}
+
+// testPosts returns n posts, newest first, created a minute apart
+func testPosts(n int) []*models.Post {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	posts := make([]*models.Post, n)
+	for i := range posts {
+		posts[i] = &models.Post{
+			ID:         fmt.Sprintf("post-%02d", n-i),
+			CreatedAt:  start.Add(time.Duration(n-i) * time.Minute),
+			Visibility: models.VisibilityPublic,
+		}
+	}
+	return posts
+}
+
+func TestNewPageLastPage(t *testing.T) {
+	for _, n := range []int{0, 1, 3} {
+		result := newPage(testPosts(n), int64(n), PageRequest{Limit: 3}, postCursorKey)
+
+		if len(result.Items) != n {
+			t.Errorf("%d rows: got %d items", n, len(result.Items))
+		}
+		if result.Items == nil {
+			t.Errorf("%d rows: items must serialize as an empty list, not null", n)
+		}
+		if result.HasMore {
+			t.Errorf("%d rows: expected hasMore to be false on the last page", n)
+		}
+		if result.NextCursor != "" {
+			t.Errorf("%d rows: expected no next_cursor on the last page, got %q", n, result.NextCursor)
+		}
+		if result.Page != 1 || result.PageSize != 3 || result.Total != int64(n) {
+			t.Errorf("%d rows: got page %d, pageSize %d, total %d", n, result.Page, result.PageSize, result.Total)
+		}
+	}
+}
+
+func TestNewPageHasMore(t *testing.T) {
+	// paginate fetches one row more than the limit to detect a following page
+	rows := testPosts(4)
+	last := rows[2]
+
+	result := newPage(rows, 10, PageRequest{Limit: 3}, postCursorKey)
+
+	if len(result.Items) != 3 {
+		t.Fatalf("got %d items, want 3", len(result.Items))
+	}
+	if !result.HasMore {
+		t.Error("expected hasMore to be true")
+	}
+
+	createdAt, id, page, err := utils.DecodeCursor(result.NextCursor)
+	if err != nil {
+		t.Fatalf("next_cursor does not decode: %v", err)
+	}
+	if !createdAt.Equal(last.CreatedAt) || id != last.ID || page != 2 {
+		t.Errorf("next_cursor points at (%s, %s, page %d), want (%s, %s, page 2)", createdAt, id, page, last.CreatedAt, last.ID)
+	}
+
+	// The page number carries over to the following pages
+	next := newPage(testPosts(4), 10, PageRequest{Cursor: result.NextCursor, Limit: 3}, postCursorKey)
+	if next.Page != 2 {
+		t.Errorf("got page %d, want 2", next.Page)
+	}
+	if _, _, page, _ := utils.DecodeCursor(next.NextCursor); page != 3 {
+		t.Errorf("got next page %d, want 3", page)
+	}
+}
+
+func TestNewPageTiesOnCreatedAt(t *testing.T) {
+	// Posts created in the same instant are told apart by their ID
+	createdAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	rows := []*models.Post{
+		{ID: "post-c", CreatedAt: createdAt},
+		{ID: "post-b", CreatedAt: createdAt},
+		{ID: "post-a", CreatedAt: createdAt},
+	}
+
+	result := newPage(rows, 3, PageRequest{Limit: 2}, postCursorKey)
+
+	gotCreatedAt, id, _, err := utils.DecodeCursor(result.NextCursor)
+	if err != nil {
+		t.Fatalf("next_cursor does not decode: %v", err)
+	}
+	if !gotCreatedAt.Equal(createdAt) || id != "post-b" {
+		t.Errorf("next_cursor points at (%s, %s), want (%s, post-b)", gotCreatedAt, id, createdAt)
+	}
+
+	// The following page continues within the tie instead of skipping or repeating it
+	scope, err := paginate("posts", PageRequest{Cursor: result.NextCursor, Limit: 2})
+	if err != nil {
+		t.Fatalf("paginate returned error: %v", err)
+	}
+	var posts []*models.Post
+	stmt := newDryRunDB(t).Model(&models.Post{}).Scopes(scope).Find(&posts).Statement
+
+	sql := stmt.SQL.String()
+	for _, want := range []string{
+		"posts.created_at < ? OR (posts.created_at = ? AND posts.id < ?)",
+		"ORDER BY posts.created_at DESC,posts.id DESC LIMIT ?",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("query %q does not contain %q", sql, want)
+		}
+	}
+	if len(stmt.Vars) != 4 || stmt.Vars[2] != "post-b" || stmt.Vars[3] != 3 {
+		t.Errorf("unexpected query parameters %v", stmt.Vars)
+	}
+}
+
+func TestPaginateRejectsInvalidCursor(t *testing.T) {
+	for _, cursor := range []string{"garbage", "e30", "!!!"} {
+		if _, err := paginate("posts", PageRequest{Cursor: cursor, Limit: 20}); !errors.Is(err, utils.ErrInvalidCursor) {
+			t.Errorf("cursor %q: expected ErrInvalidCursor, got %v", cursor, err)
+		}
+	}
+}
+
+func TestFilterVisibleAfterPagingKeepsCursor(t *testing.T) {
+	// listPosts filters in SQL with visibleTo, then checks CanView again. Should the two ever
+	// disagree, the page comes back short but its cursor still points past every fetched row,
+	// so no post the viewer may see is skipped.
+	rows := testPosts(4)
+	rows[2].Visibility = models.VisibilityPrivate
+	last := rows[2]
+
+	result := newPage(rows, 4, PageRequest{Limit: 3}, postCursorKey)
+	result.Items = filterVisible(&Viewer{}, result.Items)
+
+	if len(result.Items) != 2 {
+		t.Fatalf("got %d items, want 2", len(result.Items))
+	}
+	if !result.HasMore {
+		t.Error("expected hasMore to be true")
+	}
+	if _, id, _, _ := utils.DecodeCursor(result.NextCursor); id != last.ID {
+		t.Errorf("next_cursor points at %s, want %s", id, last.ID)
+	}
+}
+
+func TestVisibleToMatchesCanView(t *testing.T) {
+	viewer := &Viewer{UserID: "viewer", FriendIDs: []string{"friend"}, GroupIDs: []string{"group"}}
+
+	var posts []*models.Post
+	stmt := newDryRunDB(t).Model(&models.Post{}).Scopes(visibleTo(viewer)).Find(&posts).Statement
+	sql := stmt.SQL.String()
+
+	// Every rule of CanView has its SQL counterpart
+	for _, want := range []string{
+		"posts.user_id = ?",
+		"posts.visibility = ?",
+		"posts.visibility = ? AND posts.user_id IN (?)",
+		"posts.visibility = ? AND posts.group_id IN (?)",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Errorf("query %q does not contain %q", sql, want)
+		}
+	}
+
+	anonymous := newDryRunDB(t).Model(&models.Post{}).Scopes(visibleTo(&Viewer{})).Find(&posts).Statement
+	if len(anonymous.Vars) != 1 || anonymous.Vars[0] != models.VisibilityPublic {
+		t.Errorf("anonymous viewers must only see public posts, got parameters %v", anonymous.Vars)
+	}
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"errors"
+	"time"
 
 	"go-azure/models"
 	"go-azure/utils"
@@ -9,6 +10,17 @@ import (
 	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrPostNotFound is returned when a post does not exist or the viewer may not see it
+	ErrPostNotFound = errors.New("post not found")
+	// ErrInvalidVisibility is returned when a post has an unknown visibility, or a group is
+	// given for a visibility other than group or missing for group visibility
+	ErrInvalidVisibility = errors.New("invalid visibility")
+	// ErrNotGroupMember is returned when posting to a group the author does not belong to
+	ErrNotGroupMember = errors.New("not a member of the group")
 )
 
 // PostService handles social media post operations
@@ -25,40 +37,205 @@ func NewPostService() *PostService {
 	}
 }
 
-// GetAllPosts returns all posts for a user
-func (s *PostService) GetAllPosts(userID string) []*models.Post {
-	var posts []*models.Post
+// GetAllPosts returns a page of the posts of a user, newest first. Anonymous visitors,
+// with an empty userID, get the public posts of all users instead.
+func (s *PostService) GetAllPosts(userID string, page PageRequest) (*models.Page[*models.Post], error) {
+	posts := func(db *gorm.DB) *gorm.DB {
+		if userID == "" {
+			return db
+		}
+		return db.Where("posts.user_id = ?", userID)
+	}
 
-	result := s.db.Where("user_id = ?", userID).Find(&posts)
-	if result.Error != nil {
-		s.logger.WithError(result.Error).Error("Failed to get posts")
-		return []*models.Post{}
+	return s.listPosts(userID, posts, page)
+}
+
+// GetFeed returns a page of the public posts of all users, newest first, with their
+// authors. Posts of deleted users and, for signed-in viewers, of users the viewer has
+// blocked are left out. Anonymous visitors have an empty viewerID.
+func (s *PostService) GetFeed(viewerID string, page PageRequest) (*models.Page[*models.Post], error) {
+	posts := func(db *gorm.DB) *gorm.DB {
+		db = db.
+			Where("posts.visibility = ?", models.VisibilityPublic).
+			Where("EXISTS (SELECT 1 FROM users WHERE users.id = posts.user_id AND users.deleted_at IS NULL)")
+		if viewerID != "" {
+			db = db.Where("NOT EXISTS (SELECT 1 FROM user_blocks WHERE user_blocks.blocker_id = ? AND user_blocks.blocked_id = posts.user_id)", viewerID)
+		}
+		return db
+	}
+
+	return s.listPosts(viewerID, posts, page)
+}
+
+// listPosts returns a page of the posts selected by the scope that the viewer may see,
+// newest first, with their authors
+func (s *PostService) listPosts(viewerID string, posts func(db *gorm.DB) *gorm.DB, page PageRequest) (*models.Page[*models.Post], error) {
+	pageScope, err := paginate("posts", page)
+	if err != nil {
+		return nil, err
+	}
+
+	viewer, err := s.loadViewer(viewerID)
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	if err := s.db.Model(&models.Post{}).Scopes(posts, visibleTo(viewer)).Count(&total).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to count posts")
+		return nil, errors.New("failed to get posts")
+	}
+
+	var rows []*models.Post
+	if err := s.db.Preload("Author").Scopes(posts, visibleTo(viewer), pageScope).Find(&rows).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get posts")
+		return nil, errors.New("failed to get posts")
+	}
+
+	// visibleTo already filtered the query, so total only counts posts the viewer may see and
+	// pages are full. Checking CanView again only drops posts if the two ever disagree; the page
+	// is cut and its cursor taken before that, so such a page is short but none are skipped.
+	result := newPage(rows, total, page, postCursorKey)
+	result.Items = filterVisible(viewer, result.Items)
+
+	if err := s.attachReactions(viewerID, result.Items...); err != nil {
+		return nil, err
 	}
 
-	return posts
+	return result, nil
 }
 
-// GetPostByID returns a post by ID
+// attachReactions loads the reaction counts of posts and the reactions the viewer gave
+// them. Counts are aggregated from the reactions themselves, so they cannot drift from
+// concurrent reactions. Anonymous visitors have an empty viewerID.
+func (s *PostService) attachReactions(viewerID string, posts ...*models.Post) error {
+	byID := make(map[string]*models.Post, len(posts))
+	postIDs := make([]string, 0, len(posts))
+	for _, post := range posts {
+		post.ReactionCounts = map[models.ReactionKind]int64{}
+		post.ViewerReactions = []models.ReactionKind{}
+		post.LikesCount = 0
+		byID[post.ID] = post
+		postIDs = append(postIDs, post.ID)
+	}
+	if len(postIDs) == 0 {
+		return nil
+	}
+
+	var counts []struct {
+		PostID string
+		Kind   models.ReactionKind
+		Count  int64
+	}
+	err := s.db.Model(&models.Reaction{}).
+		Select("post_id, kind, COUNT(*) AS count").
+		Where("post_id IN ?", postIDs).
+		Group("post_id, kind").
+		Scan(&counts).Error
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to count reactions")
+		return errors.New("failed to get reactions")
+	}
+	for _, count := range counts {
+		post := byID[count.PostID]
+		post.ReactionCounts[count.Kind] = count.Count
+		if count.Kind == models.ReactionLike {
+			post.LikesCount = count.Count
+		}
+	}
+
+	if viewerID == "" {
+		return nil
+	}
+
+	var reactions []models.Reaction
+	err = s.db.Where("user_id = ? AND post_id IN ?", viewerID, postIDs).
+		Order("created_at").
+		Find(&reactions).Error
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to get viewer reactions")
+		return errors.New("failed to get reactions")
+	}
+	for _, reaction := range reactions {
+		post := byID[reaction.PostID]
+		post.ViewerReactions = append(post.ViewerReactions, reaction.Kind)
+	}
+
+	return nil
+}
+
+// postCursorKey returns the pagination key of a post
+func postCursorKey(post *models.Post) (time.Time, string) {
+	return post.CreatedAt, post.ID
+}
+
+// GetPostByID returns a post by ID if the user may see it. Anonymous visitors, with an
+// empty userID, only see public posts.
 func (s *PostService) GetPostByID(postID string, userID string) (*models.Post, error) {
 	var post models.Post
 
-	result := s.db.Where("id = ? AND user_id = ?", postID, userID).First(&post)
+	result := s.db.Preload("Author").Where("id = ?", postID).First(&post)
 	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrPostNotFound
+		}
 		s.logger.WithError(result.Error).Error("Failed to get post")
-		return nil, errors.New("post not found")
+		return nil, errors.New("failed to get post")
+	}
+
+	viewer, err := s.loadViewer(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !CanView(viewer, &post) {
+		return nil, ErrPostNotFound
+	}
+
+	if err := s.attachReactions(userID, &post); err != nil {
+		return nil, err
 	}
 
 	return &post, nil
 }
 
+// checkAudience validates the visibility and group of a post by the user, defaulting
+// an empty visibility to public
+func (s *PostService) checkAudience(post *models.Post, userID string) error {
+	if post.Visibility == "" {
+		post.Visibility = models.VisibilityPublic
+	}
+	if !post.Visibility.IsValid() || (post.Visibility == models.VisibilityGroup) != (post.GroupID != "") {
+		return ErrInvalidVisibility
+	}
+	if post.Visibility != models.VisibilityGroup {
+		return nil
+	}
+
+	var count int64
+	if err := s.db.Model(&models.GroupMembership{}).Where("group_id = ? AND user_id = ?", post.GroupID, userID).Count(&count).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to query group membership")
+		return errors.New("failed to query group membership")
+	}
+	if count == 0 {
+		return ErrNotGroupMember
+	}
+
+	return nil
+}
+
 // CreatePost creates a new post
 func (s *PostService) CreatePost(post *models.Post, userID string) (*models.Post, error) {
+	if err := s.checkAudience(post, userID); err != nil {
+		return nil, err
+	}
+
 	// Set post ID and user ID
 	post.ID = uuid.New().String()
 	post.UserID = userID
+	post.CommentsCount = 0
 
-	// Create post in database
-	result := s.db.Create(post)
+	// Create post in database; the author is never written through a post
+	result := s.db.Omit(clause.Associations).Create(post)
 	if result.Error != nil {
 		s.logger.WithError(result.Error).Error("Failed to create post")
 		return nil, errors.New("failed to create post")
@@ -69,6 +246,11 @@ func (s *PostService) CreatePost(post *models.Post, userID string) (*models.Post
 		"user_id": userID,
 	}).Info("Post created")
 
+	// A new post has no reactions yet
+	post.ReactionCounts = map[models.ReactionKind]int64{}
+	post.LikesCount = 0
+	post.ViewerReactions = []models.ReactionKind{}
+
 	return post, nil
 }
 
@@ -79,16 +261,21 @@ func (s *PostService) UpdatePost(postID string, updatedPost *models.Post, userID
 	result := s.db.Where("id = ? AND user_id = ?", postID, userID).First(&existingPost)
 	if result.Error != nil {
 		s.logger.WithError(result.Error).Error("Failed to get post for update")
-		return nil, errors.New("post not found")
+		return nil, ErrPostNotFound
+	}
+
+	if err := s.checkAudience(updatedPost, userID); err != nil {
+		return nil, err
 	}
 
 	// Update post fields
 	existingPost.Caption = updatedPost.Caption
 	existingPost.Content = updatedPost.Content
-	existingPost.IsPublic = updatedPost.IsPublic
+	existingPost.Visibility = updatedPost.Visibility
+	existingPost.GroupID = updatedPost.GroupID
 
-	// Save changes to database
-	result = s.db.Save(&existingPost)
+	// Save changes to database, leaving counters maintained elsewhere untouched
+	result = s.db.Model(&existingPost).Select("caption", "content", "visibility", "group_id").Updates(&existingPost)
 	if result.Error != nil {
 		s.logger.WithError(result.Error).Error("Failed to update post")
 		return nil, errors.New("failed to update post")
@@ -99,6 +286,10 @@ func (s *PostService) UpdatePost(postID string, updatedPost *models.Post, userID
 		"user_id": userID,
 	}).Info("Post updated")
 
+	if err := s.attachReactions(userID, &existingPost); err != nil {
+		return nil, err
+	}
+
 	return &existingPost, nil
 }
 
@@ -109,7 +300,7 @@ func (s *PostService) DeletePost(postID string, userID string) error {
 	result := s.db.Where("id = ? AND user_id = ?", postID, userID).First(&post)
 	if result.Error != nil {
 		s.logger.WithError(result.Error).Error("Failed to get post for deletion")
-		return errors.New("post not found")
+		return ErrPostNotFound
 	}
 
 	// Delete post
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"slices"
+
+	"go-azure/models"
+
+	"gorm.io/gorm"
+)
+
+// Viewer is the user a post is shown to, along with the relationships post visibility
+// depends on. Anonymous visitors have an empty UserID.
+type Viewer struct {
+	UserID    string
+	FriendIDs []string
+	GroupIDs  []string
+}
+
+// loadViewer loads the friends and groups of a user. An empty userID gives the anonymous viewer.
+func (s *PostService) loadViewer(userID string) (*Viewer, error) {
+	viewer := &Viewer{UserID: userID}
+	if userID == "" {
+		return viewer, nil
+	}
+
+	if err := s.db.Model(&models.Friendship{}).Where("user_id = ?", userID).Pluck("friend_id", &viewer.FriendIDs).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get friends of viewer")
+		return nil, errors.New("failed to get posts")
+	}
+
+	if err := s.db.Model(&models.GroupMembership{}).Where("user_id = ?", userID).Pluck("group_id", &viewer.GroupIDs).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to get groups of viewer")
+		return nil, errors.New("failed to get posts")
+	}
+
+	return viewer, nil
+}
+
+// CanView reports whether the viewer may see the post. It is the single source of truth
+// for post visibility: every read path checks it, and visibleTo mirrors it in SQL so
+// listings can filter before paginating. Change both together.
+func CanView(viewer *Viewer, post *models.Post) bool {
+	if viewer.UserID != "" && post.UserID == viewer.UserID {
+		return true
+	}
+
+	switch post.Visibility {
+	case models.VisibilityPublic:
+		return true
+	case models.VisibilityFriends:
+		return slices.Contains(viewer.FriendIDs, post.UserID)
+	case models.VisibilityGroup:
+		return post.GroupID != "" && slices.Contains(viewer.GroupIDs, post.GroupID)
+	default:
+		return false
+	}
+}
+
+// visibleTo restricts a posts query to the posts CanView lets the viewer see
+func visibleTo(viewer *Viewer) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if viewer.UserID == "" {
+			return db.Where("posts.visibility = ?", models.VisibilityPublic)
+		}
+
+		condition := db.Session(&gorm.Session{NewDB: true}).
+			Where("posts.user_id = ?", viewer.UserID).
+			Or("posts.visibility = ?", models.VisibilityPublic)
+		if len(viewer.FriendIDs) > 0 {
+			condition = condition.Or("posts.visibility = ? AND posts.user_id IN ?", models.VisibilityFriends, viewer.FriendIDs)
+		}
+		if len(viewer.GroupIDs) > 0 {
+			condition = condition.Or("posts.visibility = ? AND posts.group_id IN ?", models.VisibilityGroup, viewer.GroupIDs)
+		}
+
+		return db.Where(condition)
+	}
+}
+
+// filterVisible drops the posts CanView does not let the viewer see
+func filterVisible(viewer *Viewer, posts []*models.Post) []*models.Post {
+	return slices.DeleteFunc(posts, func(post *models.Post) bool {
+		return !CanView(viewer, post)
+	})
+}
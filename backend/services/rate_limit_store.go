@@ -0,0 +1,332 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RateLimit is a token bucket allowing Burst requests at once, refilled at Rate requests per Per.
+// A Rate of zero or less disables the limit.
+type RateLimit struct {
+	Rate  int
+	Per   time.Duration
+	Burst int
+}
+
+// Disabled reports whether the limit lets every request through
+func (l RateLimit) Disabled() bool {
+	return l.Rate <= 0
+}
+
+// interval returns the time it takes to refill one token
+func (l RateLimit) interval() time.Duration {
+	return l.Per / time.Duration(l.Rate)
+}
+
+// BackoffPolicy locks a key out with exponential backoff after repeated failures. The first
+// FreeAttempts failures are not penalized; each further failure doubles the lockout starting
+// at Base, up to Max. Failures are forgotten after ResetAfter without new ones.
+type BackoffPolicy struct {
+	FreeAttempts int
+	Base         time.Duration
+	Max          time.Duration
+	ResetAfter   time.Duration
+}
+
+// NewLoginBackoffPolicy returns the lockout policy for failed logins and second factors:
+// LOGIN_MAX_FAILURES free attempts, then lockouts doubling from 30 seconds up to
+// LOGIN_LOCKOUT_MAX_MINUTES
+func NewLoginBackoffPolicy(cfg *config.Config) BackoffPolicy {
+	return BackoffPolicy{
+		FreeAttempts: cfg.LoginMaxFailures,
+		Base:         30 * time.Second,
+		Max:          time.Duration(cfg.LoginLockoutMaxMinutes) * time.Minute,
+		ResetAfter:   time.Hour,
+	}
+}
+
+// NewAccountRateLimit returns the per-account limit: AUTH_ACCOUNT_RATE_LIMIT_PER_MINUTE
+// requests per account, however many IPs they come from
+func NewAccountRateLimit(cfg *config.Config) RateLimit {
+	return RateLimit{
+		Rate:  cfg.AuthAccountRateLimitPerMinute,
+		Per:   time.Minute,
+		Burst: cfg.AuthAccountRateLimitPerMinute,
+	}
+}
+
+// takeAccountToken takes a token from the per-account bucket of key, returning a
+// ThrottledError when it is empty. Like the per-IP limiter it fails open when the
+// store is unavailable.
+func takeAccountToken(store RateLimitStore, limit RateLimit, key string) error {
+	wait, err := store.Take("account:"+key, limit)
+	if err != nil {
+		utils.GetLogger().WithError(err).Error("Failed to check account rate limit")
+		return nil
+	}
+	if wait > 0 {
+		return &ThrottledError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// ThrottledError is returned when a key is rate limited or locked out
+type ThrottledError struct {
+	RetryAfter time.Duration
+}
+
+// Error returns the error message
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("too many attempts, retry after %s", e.RetryAfter.Round(time.Second))
+}
+
+// RateLimitStore keeps the token buckets and failure counters used for rate limiting
+type RateLimitStore interface {
+	// Take removes a token from the bucket of key. It returns zero if the request is allowed,
+	// or how long to wait until a token is available.
+	Take(key string, limit RateLimit) (time.Duration, error)
+	// BlockedFor returns how long key is still locked out, or zero
+	BlockedFor(key string) (time.Duration, error)
+	// RecordFailure counts a failure against key and returns the resulting lockout, or zero
+	RecordFailure(key string, policy BackoffPolicy) (time.Duration, error)
+	// Reset forgets the failures of key
+	Reset(key string) error
+	// PurgeExpired removes entries that no longer affect any limit
+	PurgeExpired() error
+}
+
+// NewRateLimitStore creates the rate limit store selected in the configuration
+func NewRateLimitStore(cfg *config.Config) RateLimitStore {
+	if cfg.RateLimitStore == "memory" {
+		return NewMemoryRateLimitStore()
+	}
+	return NewDatabaseRateLimitStore(utils.GetDB())
+}
+
+// takeToken refills the bucket of entry for the time elapsed since its last update and
+// takes a token from it, returning how long to wait if it is empty
+func takeToken(entry *models.RateLimitEntry, limit RateLimit, now time.Time) time.Duration {
+	if limit.Disabled() {
+		return 0
+	}
+
+	interval := limit.interval()
+
+	elapsed := now.Sub(entry.UpdatedAt)
+	entry.Tokens = math.Min(float64(limit.Burst), entry.Tokens+float64(elapsed)/float64(interval))
+	entry.UpdatedAt = now
+	// An untouched bucket is full again after refilling every token
+	entry.ExpiresAt = now.Add(interval * time.Duration(limit.Burst))
+
+	if entry.Tokens < 1 {
+		return time.Duration((1 - entry.Tokens) * float64(interval))
+	}
+
+	entry.Tokens--
+	return 0
+}
+
+// recordFailure counts a failure against entry and returns the lockout it triggers
+func recordFailure(entry *models.RateLimitEntry, policy BackoffPolicy, now time.Time) time.Duration {
+	if now.Sub(entry.UpdatedAt) > policy.ResetAfter {
+		entry.Failures = 0
+	}
+	entry.Failures++
+	entry.UpdatedAt = now
+	entry.ExpiresAt = now.Add(policy.ResetAfter)
+
+	excess := entry.Failures - policy.FreeAttempts
+	if excess <= 0 {
+		return 0
+	}
+
+	lockout := policy.Max
+	if excess <= 30 {
+		lockout = min(policy.Base<<(excess-1), policy.Max)
+	}
+	entry.BlockedUntil = now.Add(lockout)
+	if entry.BlockedUntil.After(entry.ExpiresAt) {
+		entry.ExpiresAt = entry.BlockedUntil
+	}
+
+	return lockout
+}
+
+// blockedFor returns the remaining lockout of entry
+func blockedFor(entry *models.RateLimitEntry, now time.Time) time.Duration {
+	if entry.BlockedUntil.After(now) {
+		return entry.BlockedUntil.Sub(now)
+	}
+	return 0
+}
+
+// MemoryRateLimitStore is a RateLimitStore kept in process memory.
+// It is suitable for single-instance deployments and development.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	entries map[string]*models.RateLimitEntry
+	now     func() time.Time
+}
+
+// NewMemoryRateLimitStore creates a new MemoryRateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		entries: make(map[string]*models.RateLimitEntry),
+		now:     time.Now,
+	}
+}
+
+// Take removes a token from the bucket of key
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &models.RateLimitEntry{BucketKey: key, Tokens: float64(limit.Burst), UpdatedAt: now}
+		s.entries[key] = entry
+	}
+
+	return takeToken(entry, limit, now), nil
+}
+
+// BlockedFor returns how long key is still locked out
+func (s *MemoryRateLimitStore) BlockedFor(key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.entries[key]
+	if !ok {
+		return 0, nil
+	}
+	return blockedFor(entry, s.now()), nil
+}
+
+// RecordFailure counts a failure against key
+func (s *MemoryRateLimitStore) RecordFailure(key string, policy BackoffPolicy) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &models.RateLimitEntry{BucketKey: key, UpdatedAt: now}
+		s.entries[key] = entry
+	}
+
+	return recordFailure(entry, policy, now), nil
+}
+
+// Reset forgets the failures of key
+func (s *MemoryRateLimitStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+	return nil
+}
+
+// PurgeExpired removes entries that no longer affect any limit
+func (s *MemoryRateLimitStore) PurgeExpired() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, entry := range s.entries {
+		if now.After(entry.ExpiresAt) {
+			delete(s.entries, key)
+		}
+	}
+	return nil
+}
+
+// DatabaseRateLimitStore is a RateLimitStore backed by the rate_limit_entries table,
+// shared by every API instance using the same database. Entries are updated under a
+// row lock, so concurrent requests on different instances cannot overdraw a bucket.
+type DatabaseRateLimitStore struct {
+	db *gorm.DB
+}
+
+// NewDatabaseRateLimitStore creates a new DatabaseRateLimitStore
+func NewDatabaseRateLimitStore(db *gorm.DB) *DatabaseRateLimitStore {
+	return &DatabaseRateLimitStore{
+		db: db,
+	}
+}
+
+// Take removes a token from the bucket of key
+func (s *DatabaseRateLimitStore) Take(key string, limit RateLimit) (time.Duration, error) {
+	var wait time.Duration
+	err := s.update(key, float64(limit.Burst), func(entry *models.RateLimitEntry, now time.Time) {
+		wait = takeToken(entry, limit, now)
+	})
+	return wait, err
+}
+
+// BlockedFor returns how long key is still locked out
+func (s *DatabaseRateLimitStore) BlockedFor(key string) (time.Duration, error) {
+	var entry models.RateLimitEntry
+	err := s.db.Where("bucket_key = ?", key).First(&entry).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return blockedFor(&entry, time.Now()), nil
+}
+
+// RecordFailure counts a failure against key
+func (s *DatabaseRateLimitStore) RecordFailure(key string, policy BackoffPolicy) (time.Duration, error) {
+	var lockout time.Duration
+	err := s.update(key, 0, func(entry *models.RateLimitEntry, now time.Time) {
+		lockout = recordFailure(entry, policy, now)
+	})
+	return lockout, err
+}
+
+// Reset forgets the failures of key
+func (s *DatabaseRateLimitStore) Reset(key string) error {
+	return s.db.Where("bucket_key = ?", key).Delete(&models.RateLimitEntry{}).Error
+}
+
+// PurgeExpired removes entries that no longer affect any limit
+func (s *DatabaseRateLimitStore) PurgeExpired() error {
+	return s.db.Where("expires_at <= ?", time.Now()).Delete(&models.RateLimitEntry{}).Error
+}
+
+// update applies fn to the entry of key while holding a row lock, creating the entry
+// with initialTokens if it does not exist yet
+func (s *DatabaseRateLimitStore) update(key string, initialTokens float64, fn func(entry *models.RateLimitEntry, now time.Time)) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Concurrent first requests race to create the row; the losers lock the winner's
+		entry := models.RateLimitEntry{BucketKey: key, Tokens: initialTokens, UpdatedAt: now, ExpiresAt: now}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entry).Error; err != nil {
+			return err
+		}
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("bucket_key = ?", key).
+			First(&entry).Error
+		if err != nil {
+			return err
+		}
+
+		fn(&entry, now)
+
+		return tx.Save(&entry).Error
+	})
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testClock is a manually advanced clock for the memory store
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newTestRateLimitStore() (*MemoryRateLimitStore, *testClock) {
+	clock := &testClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryRateLimitStore()
+	store.now = clock.Now
+	return store, clock
+}
+
+func TestMemoryRateLimitStoreTokenBucket(t *testing.T) {
+	store, clock := newTestRateLimitStore()
+	limit := RateLimit{Rate: 6, Per: time.Minute, Burst: 3}
+
+	take := func() time.Duration {
+		t.Helper()
+		wait, err := store.Take("ip:test", limit)
+		if err != nil {
+			t.Fatalf("Take returned error: %v", err)
+		}
+		return wait
+	}
+
+	// A full bucket allows a burst
+	for i := 0; i < limit.Burst; i++ {
+		if wait := take(); wait != 0 {
+			t.Fatalf("request %d of the burst was throttled for %s", i+1, wait)
+		}
+	}
+
+	// An empty bucket reports the time until the next token, one every 10 seconds
+	if wait := take(); wait != 10*time.Second {
+		t.Fatalf("got wait %s, want 10s", wait)
+	}
+
+	clock.Advance(4 * time.Second)
+	if wait := take(); wait != 6*time.Second {
+		t.Fatalf("got wait %s, want 6s", wait)
+	}
+
+	// Refilled tokens are spent one at a time
+	clock.Advance(6 * time.Second)
+	if wait := take(); wait != 0 {
+		t.Fatalf("refilled token was throttled for %s", wait)
+	}
+	if wait := take(); wait != 10*time.Second {
+		t.Fatalf("got wait %s, want 10s", wait)
+	}
+
+	// A long idle period refills no more than the burst
+	clock.Advance(time.Hour)
+	for i := 0; i < limit.Burst; i++ {
+		if wait := take(); wait != 0 {
+			t.Fatalf("request %d after idling was throttled for %s", i+1, wait)
+		}
+	}
+	if wait := take(); wait == 0 {
+		t.Fatal("expected the bucket to hold no more than the burst")
+	}
+
+	// Buckets are per key
+	if wait, _ := store.Take("ip:other", limit); wait != 0 {
+		t.Fatalf("another key was throttled for %s", wait)
+	}
+}
+
+func TestMemoryRateLimitStoreDisabledLimit(t *testing.T) {
+	store, _ := newTestRateLimitStore()
+
+	for _, rate := range []int{0, -1} {
+		limit := RateLimit{Rate: rate, Per: time.Minute, Burst: rate}
+		for i := 0; i < 100; i++ {
+			if wait, err := store.Take("ip:test", limit); err != nil || wait != 0 {
+				t.Fatalf("rate %d: request %d got wait %s, err %v", rate, i+1, wait, err)
+			}
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreBackoff(t *testing.T) {
+	store, clock := newTestRateLimitStore()
+	policy := BackoffPolicy{FreeAttempts: 2, Base: 30 * time.Second, Max: 2 * time.Minute, ResetAfter: time.Hour}
+
+	fail := func() time.Duration {
+		t.Helper()
+		lockout, err := store.RecordFailure("login:test", policy)
+		if err != nil {
+			t.Fatalf("RecordFailure returned error: %v", err)
+		}
+		return lockout
+	}
+	blocked := func() time.Duration {
+		t.Helper()
+		wait, err := store.BlockedFor("login:test")
+		if err != nil {
+			t.Fatalf("BlockedFor returned error: %v", err)
+		}
+		return wait
+	}
+
+	// Free attempts are not penalized, later ones double the lockout up to the maximum
+	for i, want := range []time.Duration{0, 0, 30 * time.Second, time.Minute, 2 * time.Minute, 2 * time.Minute} {
+		if lockout := fail(); lockout != want {
+			t.Fatalf("failure %d: got lockout %s, want %s", i+1, lockout, want)
+		}
+		if wait := blocked(); wait != want {
+			t.Fatalf("failure %d: blocked for %s, want %s", i+1, wait, want)
+		}
+	}
+
+	// The lockout runs out
+	clock.Advance(90 * time.Second)
+	if wait := blocked(); wait != 30*time.Second {
+		t.Fatalf("blocked for %s, want 30s", wait)
+	}
+	clock.Advance(30 * time.Second)
+	if wait := blocked(); wait != 0 {
+		t.Fatalf("still blocked for %s after the lockout", wait)
+	}
+
+	// Failures are forgotten after ResetAfter without new ones
+	clock.Advance(policy.ResetAfter + time.Second)
+	if lockout := fail(); lockout != 0 {
+		t.Fatalf("got lockout %s after the failures expired, want none", lockout)
+	}
+
+	// Reset forgets failures at once, as after a successful login
+	fail()
+	if err := store.Reset("login:test"); err != nil {
+		t.Fatalf("Reset returned error: %v", err)
+	}
+	if lockout := fail(); lockout != 0 {
+		t.Fatalf("got lockout %s after a reset, want none", lockout)
+	}
+}
+
+func TestMemoryRateLimitStorePurgeExpired(t *testing.T) {
+	store, clock := newTestRateLimitStore()
+	limit := RateLimit{Rate: 6, Per: time.Minute, Burst: 3}
+
+	store.Take("ip:test", limit)
+	store.RecordFailure("login:test", BackoffPolicy{FreeAttempts: 5, Base: time.Second, Max: time.Minute, ResetAfter: time.Hour})
+
+	// The bucket is full again after 30 seconds; the failure is kept for an hour
+	clock.Advance(time.Minute)
+	store.PurgeExpired()
+	if _, ok := store.entries["ip:test"]; ok {
+		t.Error("expected the refilled bucket to be purged")
+	}
+	if _, ok := store.entries["login:test"]; !ok {
+		t.Error("expected the failure to be kept")
+	}
+}
+
+func TestTakeAccountToken(t *testing.T) {
+	store, clock := newTestRateLimitStore()
+	limit := RateLimit{Rate: 2, Per: time.Minute, Burst: 2}
+
+	for i := 0; i < limit.Burst; i++ {
+		if err := takeAccountToken(store, limit, "login:user@example.com"); err != nil {
+			t.Fatalf("attempt %d: unexpected error %v", i+1, err)
+		}
+	}
+
+	err := takeAccountToken(store, limit, "login:user@example.com")
+	var throttled *ThrottledError
+	if !errors.As(err, &throttled) || throttled.RetryAfter != 30*time.Second {
+		t.Fatalf("expected a ThrottledError with a 30s retry, got %v", err)
+	}
+
+	// Account buckets do not share keys with lockouts
+	if wait, _ := store.BlockedFor("login:user@example.com"); wait != 0 {
+		t.Fatalf("account limit locked out the login key for %s", wait)
+	}
+
+	clock.Advance(30 * time.Second)
+	if err := takeAccountToken(store, limit, "login:user@example.com"); err != nil {
+		t.Fatalf("unexpected error after refill: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidReaction is returned for an unknown reaction kind
+var ErrInvalidReaction = errors.New("invalid reaction")
+
+// ReactionService handles likes and emoji reactions on posts. Users can only react to
+// posts they can see.
+type ReactionService struct {
+	db          *gorm.DB
+	logger      *logrus.Logger
+	postService *PostService
+}
+
+// NewReactionService creates a new ReactionService
+func NewReactionService(postService *PostService) *ReactionService {
+	return &ReactionService{
+		db:          utils.GetDB(),
+		logger:      utils.GetLogger(),
+		postService: postService,
+	}
+}
+
+// AddReaction gives a post a kind of reaction from the user and returns the post with its
+// updated reactions. Adding a reaction the user already gave succeeds without change.
+func (s *ReactionService) AddReaction(postID string, userID string, kind models.ReactionKind) (*models.Post, error) {
+	if !kind.IsValid() {
+		return nil, ErrInvalidReaction
+	}
+
+	if _, err := s.postService.GetPostByID(postID, userID); err != nil {
+		return nil, err
+	}
+
+	// The primary key makes concurrent duplicate reactions collapse into one row
+	reaction := models.Reaction{PostID: postID, UserID: userID, Kind: kind}
+	result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&reaction)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to add reaction")
+		return nil, errors.New("failed to add reaction")
+	}
+
+	if result.RowsAffected > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"post_id": postID,
+			"user_id": userID,
+			"kind":    kind,
+		}).Info("Reaction added")
+	}
+
+	return s.postService.GetPostByID(postID, userID)
+}
+
+// RemoveReaction takes back a kind of reaction the user gave a post and returns the post
+// with its updated reactions. Removing a reaction the user did not give succeeds without change.
+func (s *ReactionService) RemoveReaction(postID string, userID string, kind models.ReactionKind) (*models.Post, error) {
+	if !kind.IsValid() {
+		return nil, ErrInvalidReaction
+	}
+
+	if _, err := s.postService.GetPostByID(postID, userID); err != nil {
+		return nil, err
+	}
+
+	result := s.db.Where("post_id = ? AND user_id = ? AND kind = ?", postID, userID, kind).Delete(&models.Reaction{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to remove reaction")
+		return nil, errors.New("failed to remove reaction")
+	}
+
+	if result.RowsAffected > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"post_id": postID,
+			"user_id": userID,
+			"kind":    kind,
+		}).Info("Reaction removed")
+	}
+
+	return s.postService.GetPostByID(postID, userID)
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"go-azure/config"
+	"go-azure/models"
+	"go-azure/utils"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RevocationStore keeps track of revoked JWT IDs until the tokens would have expired anyway
+type RevocationStore interface {
+	// Revoke marks the token with the given jti as revoked until expiresAt
+	Revoke(jti string, userID string, expiresAt time.Time) error
+	// IsRevoked reports whether the token with the given jti has been revoked
+	IsRevoked(jti string) (bool, error)
+	// PurgeExpired removes entries whose tokens have already expired
+	PurgeExpired() error
+}
+
+// NewRevocationStore creates the revocation store selected in the configuration
+func NewRevocationStore(cfg *config.Config) RevocationStore {
+	if cfg.RevocationStore == "memory" {
+		return NewMemoryRevocationStore()
+	}
+	return NewDatabaseRevocationStore(utils.GetDB())
+}
+
+// MemoryRevocationStore is a RevocationStore kept in process memory.
+// It is suitable for single-instance deployments and development.
+type MemoryRevocationStore struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+// NewMemoryRevocationStore creates a new MemoryRevocationStore
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		entries: make(map[string]time.Time),
+	}
+}
+
+// Revoke marks the token with the given jti as revoked until expiresAt
+func (s *MemoryRevocationStore) Revoke(jti string, userID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries[jti] = expiresAt
+	return nil
+}
+
+// IsRevoked reports whether the token with the given jti has been revoked
+func (s *MemoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expiresAt, ok := s.entries[jti]
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+// PurgeExpired removes entries whose tokens have already expired
+func (s *MemoryRevocationStore) PurgeExpired() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for jti, expiresAt := range s.entries {
+		if now.After(expiresAt) {
+			delete(s.entries, jti)
+		}
+	}
+	return nil
+}
+
+// DatabaseRevocationStore is a RevocationStore backed by the revoked_tokens table,
+// shared by every API instance using the same database
+type DatabaseRevocationStore struct {
+	db *gorm.DB
+}
+
+// NewDatabaseRevocationStore creates a new DatabaseRevocationStore
+func NewDatabaseRevocationStore(db *gorm.DB) *DatabaseRevocationStore {
+	return &DatabaseRevocationStore{
+		db: db,
+	}
+}
+
+// Revoke marks the token with the given jti as revoked until expiresAt
+func (s *DatabaseRevocationStore) Revoke(jti string, userID string, expiresAt time.Time) error {
+	revoked := models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&revoked).Error
+}
+
+// IsRevoked reports whether the token with the given jti has been revoked
+func (s *DatabaseRevocationStore) IsRevoked(jti string) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.RevokedToken{}).
+		Where("jti = ? AND expires_at > ?", jti, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// PurgeExpired removes entries whose tokens have already expired
+func (s *DatabaseRevocationStore) PurgeExpired() error {
+	return s.db.Where("expires_at <= ?", time.Now()).Delete(&models.RevokedToken{}).Error
+}
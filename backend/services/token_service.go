@@ -0,0 +1,153 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// PersonalAccessTokenPrefix marks bearer tokens that are personal access tokens rather than JWTs
+const PersonalAccessTokenPrefix = "pat_"
+
+var (
+	// ErrTokenNotFound is returned when a personal access token does not exist or belongs to another user
+	ErrTokenNotFound = errors.New("token not found")
+	// ErrInvalidScope is returned when a requested scope is unknown or not allowed for the user
+	ErrInvalidScope = errors.New("invalid scope")
+	// ErrInvalidAccessToken is returned when a personal access token is unknown or expired
+	ErrInvalidAccessToken = errors.New("invalid personal access token")
+)
+
+// TokenService handles personal access token operations
+type TokenService struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewTokenService creates a new TokenService
+func NewTokenService() *TokenService {
+	return &TokenService{
+		db:     utils.GetDB(),
+		logger: utils.GetLogger(),
+	}
+}
+
+// ListTokens returns the personal access tokens of a user
+func (s *TokenService) ListTokens(userID string) []*models.PersonalAccessToken {
+	var tokens []*models.PersonalAccessToken
+
+	result := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to get tokens")
+		return []*models.PersonalAccessToken{}
+	}
+
+	return tokens
+}
+
+// CreateToken creates a personal access token for a user and returns it together with the raw
+// token, which is shown once and never stored. A zero expiresInDays creates a non-expiring token.
+func (s *TokenService) CreateToken(user *models.User, name string, scopes []models.Scope, expiresInDays int) (*models.PersonalAccessToken, string, error) {
+	for _, scope := range scopes {
+		if !scope.IsValid() || (scope == models.ScopeAdmin && user.Role != models.RoleAdmin) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	rawToken := PersonalAccessTokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	token := &models.PersonalAccessToken{
+		ID:          uuid.New().String(),
+		UserID:      user.ID,
+		Name:        name,
+		TokenHash:   utils.HashToken(rawToken),
+		TokenPrefix: rawToken[:len(PersonalAccessTokenPrefix)+6],
+		Scopes:      scopes,
+	}
+	if expiresInDays > 0 {
+		expiresAt := time.Now().Add(time.Hour * 24 * time.Duration(expiresInDays))
+		token.ExpiresAt = &expiresAt
+	}
+
+	// Create token in database
+	result := s.db.Create(token)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to create token")
+		return nil, "", errors.New("failed to create token")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"token_id": token.ID,
+		"user_id":  user.ID,
+	}).Info("Personal access token created")
+
+	return token, rawToken, nil
+}
+
+// DeleteToken deletes a personal access token of a user
+func (s *TokenService) DeleteToken(tokenID string, userID string) error {
+	result := s.db.Where("id = ? AND user_id = ?", tokenID, userID).Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to delete token")
+		return errors.New("failed to delete token")
+	}
+	if result.RowsAffected == 0 {
+		return ErrTokenNotFound
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"token_id": tokenID,
+		"user_id":  userID,
+	}).Info("Personal access token deleted")
+
+	return nil
+}
+
+// ValidateToken resolves a raw personal access token to the token and its owner,
+// recording its use at most once a minute
+func (s *TokenService) ValidateToken(rawToken string) (*models.PersonalAccessToken, *models.User, error) {
+	if !strings.HasPrefix(rawToken, PersonalAccessTokenPrefix) {
+		return nil, nil, ErrInvalidAccessToken
+	}
+
+	var token models.PersonalAccessToken
+	result := s.db.Where("token_hash = ?", utils.HashToken(rawToken)).First(&token)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidAccessToken
+		}
+		s.logger.WithError(result.Error).Error("Failed to query token")
+		return nil, nil, errors.New("failed to query token")
+	}
+
+	now := time.Now()
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, nil, ErrInvalidAccessToken
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", token.UserID).First(&user).Error; err != nil {
+		return nil, nil, ErrInvalidAccessToken
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > time.Minute {
+		if err := s.db.Model(&token).Update("last_used_at", now).Error; err != nil {
+			s.logger.WithError(err).Warn("Failed to update token last used time")
+		}
+	}
+
+	return &token, &user, nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"go-azure/models"
+	"go-azure/utils"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrUserNotFound is returned when a user does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidRole is returned when a role is not part of the permission matrix
+	ErrInvalidRole = errors.New("invalid role")
+	// ErrUserExists is returned when creating a user with an email or username that is already taken
+	ErrUserExists = errors.New("email or username already taken")
+	// ErrCannotBlockSelf is returned when a user tries to block themselves
+	ErrCannotBlockSelf = errors.New("cannot block yourself")
+)
+
+// UserService handles user administration operations
+type UserService struct {
+	db     *gorm.DB
+	logger *logrus.Logger
+}
+
+// NewUserService creates a new UserService
+func NewUserService() *UserService {
+	return &UserService{
+		db:     utils.GetDB(),
+		logger: utils.GetLogger(),
+	}
+}
+
+// GetUserByID returns a user by ID
+func (s *UserService) GetUserByID(userID string) (*models.User, error) {
+	var user models.User
+
+	result := s.db.Where("id = ?", userID).First(&user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		s.logger.WithError(result.Error).Error("Failed to get user")
+		return nil, errors.New("failed to get user")
+	}
+
+	return &user, nil
+}
+
+// UpdateRole changes the role of a user. The new role is embedded in tokens
+// issued from the user's next login or token refresh.
+func (s *UserService) UpdateRole(userID string, role models.Role) (*models.User, error) {
+	if !role.IsValid() {
+		return nil, ErrInvalidRole
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Update role
+	result := s.db.Model(user).Update("role", role)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to update user role")
+		return nil, errors.New("failed to update user role")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": userID,
+		"role":    role,
+	}).Info("User role updated")
+
+	return user, nil
+}
+
+// CreateUser provisions a user ahead of their first sign-in, which is the only way
+// new users can join in invite-only mode. The username defaults to the email's local part.
+func (s *UserService) CreateUser(email string, name string, role models.Role) (*models.User, error) {
+	if !role.IsValid() {
+		return nil, ErrInvalidRole
+	}
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = email[:strings.LastIndex(email, "@")]
+	}
+
+	// Check if email or username is already taken
+	var count int64
+	if err := s.db.Model(&models.User{}).Where("email = ? OR name = ?", email, name).Count(&count).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to query user")
+		return nil, errors.New("failed to query user")
+	}
+	if count > 0 {
+		return nil, ErrUserExists
+	}
+
+	user := models.User{
+		ID:        uuid.New().String(),
+		Email:     email,
+		Name:      name,
+		Role:      role,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+
+	// Save user to database
+	if err := s.db.Create(&user).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to create user")
+		return nil, errors.New("failed to create user")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id": user.ID,
+		"email":   user.Email,
+		"role":    user.Role,
+	}).Info("User provisioned")
+
+	return &user, nil
+}
+
+// BlockUser blocks a user, hiding their posts from the blocker's feed. Blocking a user
+// who is already blocked succeeds.
+func (s *UserService) BlockUser(blockerID string, blockedID string) error {
+	if blockerID == blockedID {
+		return ErrCannotBlockSelf
+	}
+
+	if _, err := s.GetUserByID(blockedID); err != nil {
+		return err
+	}
+
+	block := models.UserBlock{BlockerID: blockerID, BlockedID: blockedID}
+	if err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&block).Error; err != nil {
+		s.logger.WithError(err).Error("Failed to block user")
+		return errors.New("failed to block user")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"user_id":    blockerID,
+		"blocked_id": blockedID,
+	}).Info("User blocked")
+
+	return nil
+}
+
+// UnblockUser removes a block. Unblocking a user who is not blocked succeeds.
+func (s *UserService) UnblockUser(blockerID string, blockedID string) error {
+	result := s.db.Where("blocker_id = ? AND blocked_id = ?", blockerID, blockedID).Delete(&models.UserBlock{})
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to unblock user")
+		return errors.New("failed to unblock user")
+	}
+
+	if result.RowsAffected > 0 {
+		s.logger.WithFields(logrus.Fields{
+			"user_id":    blockerID,
+			"blocked_id": blockedID,
+		}).Info("User unblocked")
+	}
+
+	return nil
+}
+
+// ListBlockedUsers returns the users a user has blocked
+func (s *UserService) ListBlockedUsers(blockerID string) ([]models.UserSummary, error) {
+	users := []models.UserSummary{}
+
+	result := s.db.
+		Joins("JOIN user_blocks ON user_blocks.blocked_id = users.id").
+		Where("user_blocks.blocker_id = ? AND users.deleted_at IS NULL", blockerID).
+		Order("user_blocks.created_at DESC").
+		Find(&users)
+	if result.Error != nil {
+		s.logger.WithError(result.Error).Error("Failed to list blocked users")
+		return nil, errors.New("failed to list blocked users")
+	}
+
+	return users, nil
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursorPosition is the position a cursor points at in a list ordered by (created_at, id),
+// along with the number of the page it leads to
+type cursorPosition struct {
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+	Page      int       `json:"p"`
+}
+
+// EncodeCursor returns an opaque cursor pointing just past the item with the given
+// creation time and ID, leading to the given page number
+func EncodeCursor(createdAt time.Time, id string, page int) string {
+	data, _ := json.Marshal(cursorPosition{CreatedAt: createdAt, ID: id, Page: page})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor returns the creation time, ID and page number a cursor from EncodeCursor points at
+func DecodeCursor(cursor string) (time.Time, string, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", 0, ErrInvalidCursor
+	}
+
+	var position cursorPosition
+	if err := json.Unmarshal(data, &position); err != nil || position.ID == "" || position.CreatedAt.IsZero() || position.Page < 2 {
+		return time.Time{}, "", 0, ErrInvalidCursor
+	}
+
+	return position.CreatedAt, position.ID, position.Page, nil
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	createdAt := time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC)
+
+	gotCreatedAt, gotID, gotPage, err := DecodeCursor(EncodeCursor(createdAt, "post-1", 3))
+	if err != nil {
+		t.Fatalf("DecodeCursor returned error: %v", err)
+	}
+	if !gotCreatedAt.Equal(createdAt) {
+		t.Errorf("got created_at %s, want %s", gotCreatedAt, createdAt)
+	}
+	if gotID != "post-1" {
+		t.Errorf("got id %q, want %q", gotID, "post-1")
+	}
+	if gotPage != 3 {
+		t.Errorf("got page %d, want 3", gotPage)
+	}
+}
+
+func TestDecodeCursorRejectsInvalidCursors(t *testing.T) {
+	encode := func(json string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(json))
+	}
+	valid := EncodeCursor(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), "post-1", 2)
+
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"empty", ""},
+		{"not base64", "!!!"},
+		{"not json", encode("garbage")},
+		{"wrong json type", encode(`["2024-05-01T00:00:00Z","post-1",2]`)},
+		{"missing id", encode(`{"c":"2024-05-01T00:00:00Z","p":2}`)},
+		{"missing created_at", encode(`{"i":"post-1","p":2}`)},
+		{"bad created_at", encode(`{"c":"yesterday","i":"post-1","p":2}`)},
+		{"missing page", encode(`{"c":"2024-05-01T00:00:00Z","i":"post-1"}`)},
+		{"first page", encode(`{"c":"2024-05-01T00:00:00Z","i":"post-1","p":1}`)},
+		{"negative page", encode(`{"c":"2024-05-01T00:00:00Z","i":"post-1","p":-4}`)},
+		{"truncated", valid[:len(valid)/2]},
+		{"padded", valid + "=="},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, _, err := DecodeCursor(tt.cursor); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
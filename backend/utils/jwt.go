@@ -11,16 +11,42 @@ import (
 	"go-azure/models"
 )
 
+const (
+	// tokenIssuer is the iss claim of the access tokens issued by this API
+	tokenIssuer = "go-azure-api"
+	// tokenAudience is the aud claim of the access tokens issued by this API
+	tokenAudience = "go-azure-api-users"
+)
+
 // Custom claims struct
 type CustomClaims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Name   string `json:"name"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	Scope     string `json:"scope"`
+	SessionID string `json:"sid,omitempty"`
+	// AMR lists the authentication methods of the session (RFC 8176) and AuthTime is when
+	// the user last authenticated, so routes can require a recent second factor
+	AMR      []string         `json:"amr,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token for a user
-func GenerateToken(userID string, email string, name string, secret string, expirationMinutes int) (*models.TokenDetails, error) {
+// TokenParams describes the user and session a JWT is issued for
+type TokenParams struct {
+	UserID    string
+	Email     string
+	Name      string
+	Role      string
+	Scopes    []models.Scope
+	SessionID string
+	AMR       []string
+	AuthTime  time.Time
+}
+
+// GenerateToken generates a new JWT token for a user, signed with the active key of the key set
+func GenerateToken(params TokenParams, keys *KeySet, expirationMinutes int) (*models.TokenDetails, error) {
 	// Create token details
 	expiresAt := time.Now().Add(time.Minute * time.Duration(expirationMinutes))
 	td := &models.TokenDetails{
@@ -31,27 +57,38 @@ func GenerateToken(userID string, email string, name string, secret string, expi
 	}
 
 	// Create claims with registered claims for better security
+	td.TokenID = uuid.New().String()
 	claims := CustomClaims{
-		UserID: userID,
-		Email:  email,
-		Name:   name,
+		UserID:    params.UserID,
+		Email:     params.Email,
+		Name:      params.Name,
+		Role:      params.Role,
+		Scope:     models.JoinScopes(params.Scopes),
+		SessionID: params.SessionID,
+		AMR:       params.AMR,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
-			Issuer:    "go-azure-api",
-			Subject:   userID,
-			ID:        uuid.New().String(),
-			Audience:  []string{"go-azure-api-users"},
+			Issuer:    tokenIssuer,
+			Subject:   params.UserID,
+			ID:        td.TokenID,
+			Audience:  []string{tokenAudience},
 		},
 	}
 
-	// Create token with custom claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	if !params.AuthTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(params.AuthTime)
+	}
+
+	// Create token with custom claims, naming the signing key so verifiers can pick it from the JWKS
+	signingKey := keys.Active()
+	token := jwt.NewWithClaims(signingKey.Method, claims)
+	token.Header["kid"] = signingKey.ID
 
 	// Sign token
 	var err error
-	td.AccessToken, err = token.SignedString([]byte(secret))
+	td.AccessToken, err = token.SignedString(signingKey.PrivateKey)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to sign JWT token")
 		return nil, err
@@ -60,16 +97,21 @@ func GenerateToken(userID string, email string, name string, secret string, expi
 	return td, nil
 }
 
-// ValidateToken validates a JWT token
-func ValidateToken(tokenString string, secret string) (jwt.MapClaims, error) {
+// ValidateToken validates a JWT token against the keys of the key set
+func ValidateToken(tokenString string, keys *KeySet) (jwt.MapClaims, error) {
 	// Parse token with custom claims
 	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		// Look up the signing key and make sure the token uses its algorithm
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Key(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %v", token.Header["kid"])
+		}
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(secret), nil
-	})
+		return key.PrivateKey.Public(), nil
+	}, jwt.WithValidMethods(keys.Algorithms()), jwt.WithIssuer(tokenIssuer), jwt.WithAudience(tokenAudience))
 
 	if err != nil {
 		logrus.WithError(err).Error("Failed to parse JWT token")
@@ -92,12 +134,19 @@ func ValidateToken(tokenString string, secret string) (jwt.MapClaims, error) {
 		"user_id": claims.UserID,
 		"email":   claims.Email,
 		"name":    claims.Name,
+		"role":    claims.Role,
+		"scope":   claims.Scope,
+		"sid":     claims.SessionID,
 		"exp":     claims.ExpiresAt.Time.Unix(),
 		"iat":     claims.IssuedAt.Time.Unix(),
 		"sub":     claims.Subject,
 		"jti":     claims.ID,
 		"iss":     claims.Issuer,
 		"aud":     claims.Audience,
+		"amr":     claims.AMR,
+	}
+	if claims.AuthTime != nil {
+		claimsMap["auth_time"] = claims.AuthTime.Time.Unix()
 	}
 
 	return claimsMap, nil
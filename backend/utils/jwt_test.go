@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go-azure/config"
+)
+
+// writeSigningKeys writes a retired Ed25519 key and a newer ES256 key to a keys directory
+func writeSigningKeys(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	_, retired, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	current, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	for kid, key := range map[string]interface{}{"2026-01-01": retired, "2026-10-01": current} {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatalf("failed to encode key: %v", err)
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+			t.Fatalf("failed to write key: %v", err)
+		}
+	}
+
+	return dir
+}
+
+func loadTestKeys(t *testing.T, dir string, activeKeyID string) *KeySet {
+	t.Helper()
+
+	keys, err := LoadSigningKeys(&config.Config{JWTKeysDir: dir, JWTActiveKeyID: activeKeyID})
+	if err != nil {
+		t.Fatalf("LoadSigningKeys returned error: %v", err)
+	}
+	return keys
+}
+
+func generateTestToken(t *testing.T, keys *KeySet) string {
+	t.Helper()
+
+	td, err := GenerateToken(TokenParams{UserID: "user-1", Email: "user@example.com", Role: "user"}, keys, 15)
+	if err != nil {
+		t.Fatalf("GenerateToken returned error: %v", err)
+	}
+	return td.AccessToken
+}
+
+func TestValidateTokenAcceptsRetiredKeyWhileLoaded(t *testing.T) {
+	dir := writeSigningKeys(t)
+
+	// Issued before the rotation, while the old key was active
+	token := generateTestToken(t, loadTestKeys(t, dir, "2026-01-01"))
+
+	// After the rotation the newest key signs, and the retired one still verifies
+	keys := loadTestKeys(t, dir, "")
+	if keys.Active().ID != "2026-10-01" {
+		t.Fatalf("got active key %s, want 2026-10-01", keys.Active().ID)
+	}
+
+	claims, err := ValidateToken(token, keys)
+	if err != nil {
+		t.Fatalf("token signed by the retired key was rejected: %v", err)
+	}
+	if claims["user_id"] != "user-1" {
+		t.Errorf("unexpected user_id claim %v", claims["user_id"])
+	}
+
+	if _, err := ValidateToken(generateTestToken(t, keys), keys); err != nil {
+		t.Fatalf("token signed by the active key was rejected: %v", err)
+	}
+}
+
+func TestValidateTokenRejectsUnknownKid(t *testing.T) {
+	dir := writeSigningKeys(t)
+	token := generateTestToken(t, loadTestKeys(t, dir, "2026-01-01"))
+
+	// Once the retired key is removed its tokens are no longer accepted
+	if err := os.Remove(filepath.Join(dir, "2026-01-01.pem")); err != nil {
+		t.Fatalf("failed to remove key: %v", err)
+	}
+	if _, err := ValidateToken(token, loadTestKeys(t, dir, "")); err == nil {
+		t.Fatal("expected a token signed by a removed key to be rejected")
+	}
+
+	// A token naming a kid that was never loaded is rejected even if another key would verify it
+	keys := loadTestKeys(t, dir, "")
+	claims := CustomClaims{
+		UserID: "user-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    tokenIssuer,
+			Audience:  []string{tokenAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	forged := jwt.NewWithClaims(keys.Active().Method, claims)
+	forged.Header["kid"] = "unknown"
+	signed, err := forged.SignedString(keys.Active().PrivateKey)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	if _, err := ValidateToken(signed, keys); err == nil {
+		t.Fatal("expected a token with an unknown kid to be rejected")
+	}
+}
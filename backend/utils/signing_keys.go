@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"go-azure/config"
+)
+
+// SigningKey is a private key used to sign JWTs, identified by its key ID (kid)
+type SigningKey struct {
+	ID         string
+	PrivateKey crypto.Signer
+	Method     jwt.SigningMethod
+}
+
+// KeySet holds the key currently used for signing and every key still accepted
+// for verification. Rotation works by adding a new key, making it active once
+// the JWKS has been picked up by verifiers, and removing the old key after the
+// longest-lived token signed with it has expired.
+type KeySet struct {
+	active *SigningKey
+	keys   map[string]*SigningKey
+}
+
+// LoadSigningKeys loads the JWT signing keys from cfg.JWTKeysDir, where every
+// *.pem file holds one private key whose kid is the file name without extension.
+// The active key is cfg.JWTActiveKeyID, or the last kid in lexical order (so
+// date-based names like 2026-10-01.pem rotate naturally). Without a directory an
+// ephemeral Ed25519 key is generated, which is only suitable for development.
+func LoadSigningKeys(cfg *config.Config) (*KeySet, error) {
+	if cfg.JWTKeysDir == "" {
+		logrus.Warn("JWT_KEYS_DIR not set, using an ephemeral signing key; tokens will not survive a restart")
+		return NewEphemeralKeySet()
+	}
+
+	paths, err := filepath.Glob(filepath.Join(cfg.JWTKeysDir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no signing keys found in %s", cfg.JWTKeysDir)
+	}
+	sort.Strings(paths)
+
+	keySet := &KeySet{keys: make(map[string]*SigningKey)}
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+		key, err := loadSigningKey(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		keySet.keys[kid] = key
+		keySet.active = key
+	}
+
+	if cfg.JWTActiveKeyID != "" {
+		active, ok := keySet.keys[cfg.JWTActiveKeyID]
+		if !ok {
+			return nil, fmt.Errorf("active signing key %q not found in %s", cfg.JWTActiveKeyID, cfg.JWTKeysDir)
+		}
+		keySet.active = active
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"active_kid": keySet.active.ID,
+		"keys":       len(keySet.keys),
+	}).Info("JWT signing keys loaded")
+
+	return keySet, nil
+}
+
+// NewEphemeralKeySet creates a key set with a single freshly generated Ed25519 key
+func NewEphemeralKeySet() (*KeySet, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{
+		ID:         "ephemeral",
+		PrivateKey: privateKey,
+		Method:     jwt.SigningMethodEdDSA,
+	}
+
+	return &KeySet{
+		active: key,
+		keys:   map[string]*SigningKey{key.ID: key},
+	}, nil
+}
+
+// Active returns the key new tokens are signed with
+func (ks *KeySet) Active() *SigningKey {
+	return ks.active
+}
+
+// Key returns the key with the given kid
+func (ks *KeySet) Key(kid string) (*SigningKey, bool) {
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Algorithms returns the JWT algorithms of all keys in the set
+func (ks *KeySet) Algorithms() []string {
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, key := range ks.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			algorithms = append(algorithms, alg)
+		}
+	}
+	return algorithms
+}
+
+// JWKS returns the public keys of the set for publication at /.well-known/jwks.json
+func (ks *KeySet) JWKS() (JSONWebKeySet, error) {
+	keySet := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, key := range ks.keys {
+		jwk, err := NewJSONWebKey(key.ID, key.Method.Alg(), key.PrivateKey.Public())
+		if err != nil {
+			return JSONWebKeySet{}, err
+		}
+		keySet.Keys = append(keySet.Keys, jwk)
+	}
+
+	sort.Slice(keySet.Keys, func(i, j int) bool {
+		return keySet.Keys[i].Kid < keySet.Keys[j].Kid
+	})
+
+	return keySet, nil
+}
+
+// loadSigningKey reads a PEM encoded PKCS#8, PKCS#1 or SEC 1 private key
+func loadSigningKey(kid string, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+
+	var privateKey interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		return &SigningKey{ID: kid, PrivateKey: key, Method: jwt.SigningMethodRS256}, nil
+	case *ecdsa.PrivateKey:
+		if key.Curve.Params().Name != "P-256" {
+			return nil, fmt.Errorf("unsupported EC curve in %s", path)
+		}
+		return &SigningKey{ID: kid, PrivateKey: key, Method: jwt.SigningMethodES256}, nil
+	case ed25519.PrivateKey:
+		return &SigningKey{ID: kid, PrivateKey: key, Method: jwt.SigningMethodEdDSA}, nil
+	default:
+		return nil, errors.New("unsupported private key type in " + path)
+	}
+}
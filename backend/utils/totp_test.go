@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890", base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// rfc6238Vectors are the SHA1 test vectors of RFC 6238 Appendix B. The RFC lists 8-digit codes;
+// the 6-digit codes are their last six digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatalf("failed to decode secret: %v", err)
+	}
+
+	for _, tt := range rfc6238Vectors {
+		if code := totpCode(key, tt.unix/totpPeriod); code != tt.code {
+			t.Errorf("at %d: got code %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	for _, tt := range rfc6238Vectors {
+		at := time.Unix(tt.unix, 0)
+		step := tt.unix / totpPeriod
+
+		tests := []struct {
+			name     string
+			code     string
+			lastStep int64
+			at       time.Time
+			wantOK   bool
+		}{
+			{"current step", tt.code, 0, at, true},
+			{"one step late", tt.code, 0, at.Add(totpPeriod * time.Second), true},
+			{"one step early", tt.code, 0, at.Add(-totpPeriod * time.Second), true},
+			{"two steps late", tt.code, 0, at.Add(2 * totpPeriod * time.Second), false},
+			{"two steps early", tt.code, 0, at.Add(-2 * totpPeriod * time.Second), false},
+			{"replayed", tt.code, step, at, false},
+			{"replayed after a later step", tt.code, step + 1, at, false},
+			{"after an earlier step", tt.code, step - 1, at, true},
+			{"surrounding spaces", " " + tt.code + " ", 0, at, true},
+			{"wrong length", tt.code[:5], 0, at, false},
+		}
+
+		for _, c := range tests {
+			// Time steps are only defined from the Unix epoch on
+			if c.at.Unix() < 0 {
+				continue
+			}
+
+			gotStep, ok := ValidateTOTP(rfc6238Secret, c.code, c.lastStep, c.at)
+			if ok != c.wantOK {
+				t.Errorf("at %d, %s: got ok %v, want %v", tt.unix, c.name, ok, c.wantOK)
+				continue
+			}
+			if ok && gotStep != step {
+				t.Errorf("at %d, %s: got step %d, want %d", tt.unix, c.name, gotStep, step)
+			}
+		}
+	}
+}
+
+func TestValidateTOTPRejectsBadSecret(t *testing.T) {
+	if _, ok := ValidateTOTP("not base32!", "287082", 0, time.Unix(59, 0)); ok {
+		t.Fatal("expected a code to be rejected for an undecodable secret")
+	}
+}
@@ -2,6 +2,7 @@ import { defineStore } from "pinia";
 import { ref, computed } from "vue";
 import { useUserStore } from "./user";
 import axios from "axios";
+import type { PaginatedResponse } from "@/types";
 
 export interface Post {
   post_id: string;
@@ -13,16 +14,19 @@ export interface Post {
   created_at: Date;
   updated_at?: Date;
   group_id?: string;
-  visibility: "public" | "private" | "group";
+  visibility: "public" | "friends" | "group" | "private";
   likes_count: number;
   comments_count: number;
-  user_likes?: string[];
+  reaction_counts?: Record<string, number>;
+  viewer_reactions?: string[];
 }
 
 export const usePostsStore = defineStore("posts", () => {
   const posts = ref<Post[]>([]);
   const loading = ref(false);
   const error = ref<string | null>(null);
+  const nextCursor = ref<string | null>(null);
+  const hasMore = ref(false);
 
   const userStore = useUserStore();
 
@@ -35,7 +39,8 @@ export const usePostsStore = defineStore("posts", () => {
   );
 
   // Actions
-  async function fetchPosts() {
+  // Fetches the first page of posts, or the page after the last one fetched when more is true
+  async function fetchPosts(more = false) {
     if (!userStore.isAuthenticated || !userStore.accessToken) {
       error.value = "Authentication required to fetch posts";
       return;
@@ -45,20 +50,23 @@ export const usePostsStore = defineStore("posts", () => {
     error.value = null;
 
     try {
-      const response = await axios.get(
+      const response = await axios.get<PaginatedResponse<any>>(
         `${import.meta.env.VITE_API_URL}/posts`,
         {
           headers: { Authorization: `Bearer ${userStore.accessToken}` },
+          params: more && nextCursor.value ? { cursor: nextCursor.value } : {},
         }
       );
 
-      if (response.data.posts && Array.isArray(response.data.posts)) {
-        const fetchedPosts = response.data.posts.map((post: any) => ({
+      if (Array.isArray(response.data.items)) {
+        const fetchedPosts = response.data.items.map((post: any) => ({
           ...post,
           created_at: new Date(post.created_at),
           updated_at: post.updated_at ? new Date(post.updated_at) : undefined,
         }));
-        posts.value = fetchedPosts;
+        posts.value = more ? [...posts.value, ...fetchedPosts] : fetchedPosts;
+        nextCursor.value = response.data.next_cursor ?? null;
+        hasMore.value = response.data.hasMore;
       }
     } catch (err: any) {
       console.error("Error fetching posts:", err);
@@ -109,7 +117,7 @@ export const usePostsStore = defineStore("posts", () => {
 
   async function createPost(
     content: string,
-    visibility: "public" | "private" | "group",
+    visibility: "public" | "friends" | "group" | "private",
     groupId?: string,
     media?: string
   ) {
@@ -162,7 +170,7 @@ export const usePostsStore = defineStore("posts", () => {
   async function updatePost(
     postId: string,
     content: string,
-    visibility: "public" | "private" | "group",
+    visibility: "public" | "friends" | "group" | "private",
     groupId?: string,
     media?: string
   ) {
@@ -215,6 +223,46 @@ export const usePostsStore = defineStore("posts", () => {
     }
   }
 
+  // Adds or removes a reaction of the current user; both requests are idempotent
+  async function setReaction(postId: string, kind: string, reacted: boolean) {
+    if (!userStore.user || !userStore.accessToken) {
+      error.value = "You must be logged in to react to a post";
+      return false;
+    }
+
+    try {
+      const response = await axios.request({
+        method: reacted ? "put" : "delete",
+        url: `${import.meta.env.VITE_API_URL}/posts/${postId}/reactions/${kind}`,
+        headers: { Authorization: `Bearer ${userStore.accessToken}` },
+      });
+
+      const index = posts.value.findIndex((p) => p.post_id === postId);
+      if (response.data.post && index !== -1) {
+        posts.value[index] = {
+          ...posts.value[index],
+          likes_count: response.data.post.likes_count,
+          reaction_counts: response.data.post.reaction_counts,
+          viewer_reactions: response.data.post.viewer_reactions,
+        };
+      }
+      return true;
+    } catch (err: any) {
+      console.error("Error updating reaction:", err);
+      error.value =
+        err.response?.data?.error || err.message || "Failed to update reaction";
+      return false;
+    }
+  }
+
+  function likePost(postId: string) {
+    return setReaction(postId, "like", true);
+  }
+
+  function unlikePost(postId: string) {
+    return setReaction(postId, "like", false);
+  }
+
   async function deletePost(postId: string) {
     if (!userStore.user || !userStore.accessToken) {
       error.value = "You must be logged in to delete a post";
@@ -251,6 +299,7 @@ export const usePostsStore = defineStore("posts", () => {
     posts,
     loading,
     error,
+    hasMore,
     publicPosts,
     userPosts,
     fetchPosts,
@@ -258,5 +307,8 @@ export const usePostsStore = defineStore("posts", () => {
     createPost,
     updatePost,
     deletePost,
+    setReaction,
+    likePost,
+    unlikePost,
   };
 });
@@ -17,6 +17,9 @@ export const useUserStore = defineStore(
     const loading = ref(false);
     const error = ref<string | null>(null);
     const accessToken = ref<string | null>(null);
+    const refreshTokenValue = ref<string | null>(null);
+    // Set while a login waits for the user's two-factor code
+    const mfaToken = ref<string | null>(null);
 
     const isAuthenticated = computed(() => !!user.value);
 
@@ -45,14 +48,15 @@ export const useUserStore = defineStore(
       }
     }
 
-    async function loginWithMicrosoft() {
+    async function loginWithMicrosoft(redirect?: string) {
       loading.value = true;
       error.value = null;
 
       try {
-        // Use backend authentication endpoint
+        // Use backend authentication endpoint; the redirect is stored with the OAuth state
         const response = await axios.get(
-          `${import.meta.env.VITE_API_URL}/auth/microsoft`
+          `${import.meta.env.VITE_API_URL}/auth/microsoft`,
+          { params: { redirect } }
         );
 
         // Process the response and set user data
@@ -74,9 +78,23 @@ export const useUserStore = defineStore(
       loading.value = true;
       error.value = null;
 
+      try {
+        if (accessToken.value) {
+          await axios.post(
+            `${import.meta.env.VITE_API_URL}/auth/signout`,
+            null,
+            { headers: { Authorization: `Bearer ${accessToken.value}` } }
+          );
+        }
+      } catch (err: any) {
+        // The local session is cleared even if the server-side sign-out fails
+        console.error("Sign out error:", err);
+      }
+
       try {
         user.value = null;
         accessToken.value = null;
+        refreshTokenValue.value = null;
       } catch (err: any) {
         error.value = err.message || "Failed to logout";
         console.error("Logout error:", err);
@@ -86,15 +104,17 @@ export const useUserStore = defineStore(
     }
 
     async function refreshToken() {
-      if (!user.value) return null;
+      if (!user.value || !refreshTokenValue.value) return null;
 
       try {
         const response = await axios.post(
-          `${import.meta.env.VITE_API_URL}/auth/refresh-token`
+          `${import.meta.env.VITE_API_URL}/auth/refresh`,
+          { refresh_token: refreshTokenValue.value }
         );
 
         if (response.data && response.data.token) {
-          accessToken.value = response.data.token;
+          accessToken.value = response.data.token.access_token;
+          refreshTokenValue.value = response.data.token.refresh_token;
           return accessToken.value;
         }
         return null;
@@ -104,24 +124,69 @@ export const useUserStore = defineStore(
       }
     }
 
-    function handleAuthCallback(
-      parsedUser: {
-        user_id: string;
-        email: string;
-        name: string;
-        avatar: string;
-      },
-      parsedToken: { user_id: string; access_token: string }
-    ) {
-      user.value = {
-        uid: parsedUser.user_id,
-        email: parsedUser.email,
-        displayName: parsedUser.name,
-        photoURL: parsedUser.avatar,
-      };
+    async function exchangeLoginCode(code: string) {
+      loading.value = true;
+      error.value = null;
+
+      try {
+        // Redeem the one-time code from the OAuth redirect for tokens
+        const response = await axios.post(
+          `${import.meta.env.VITE_API_URL}/auth/exchange`,
+          { code }
+        );
+
+        // Users with two-factor authentication must complete a challenge first
+        if (response.data && response.data.mfa_required) {
+          mfaToken.value = response.data.mfa_token;
+          return null;
+        }
+
+        return setSession(response.data);
+      } catch (err: any) {
+        error.value = err.message || "Failed to complete login";
+        console.error("Login code exchange error:", err);
+        return null;
+      } finally {
+        loading.value = false;
+      }
+    }
+
+    async function completeMfaChallenge(code: string) {
+      loading.value = true;
+      error.value = null;
+
+      try {
+        const response = await axios.post(
+          `${import.meta.env.VITE_API_URL}/auth/mfa/challenge`,
+          { mfa_token: mfaToken.value, code }
+        );
 
-      accessToken.value = parsedToken.access_token;
+        mfaToken.value = null;
+        return setSession(response.data);
+      } catch (err: any) {
+        error.value =
+          err.response?.data?.error || err.message || "Failed to verify code";
+        console.error("MFA challenge error:", err);
+        return null;
+      } finally {
+        loading.value = false;
+      }
+    }
+
+    // Store the user and tokens of a completed login
+    function setSession(data: any) {
+      if (!data || !data.token || !data.user) {
+        throw new Error("Invalid response from authentication server");
+      }
 
+      user.value = {
+        uid: data.user.id,
+        email: data.user.email,
+        displayName: data.user.username,
+        photoURL: data.user.avatar_url || null,
+      };
+      accessToken.value = data.token.access_token;
+      refreshTokenValue.value = data.token.refresh_token ?? null;
       return user.value;
     }
 
@@ -130,19 +195,22 @@ export const useUserStore = defineStore(
       loading,
       error,
       accessToken,
+      refreshTokenValue,
+      mfaToken,
       isAuthenticated,
       loginWithGoogle,
       loginWithMicrosoft,
       logout,
       refreshToken,
-      handleAuthCallback,
+      exchangeLoginCode,
+      completeMfaChallenge,
     };
   },
   {
     persist: {
       key: "user-store",
       storage: localStorage,
-      paths: ["user", "accessToken"],
+      paths: ["user", "accessToken", "refreshTokenValue"],
     },
   }
 );
@@ -31,7 +31,7 @@ export interface AuthState {
 }
 
 // Post related types
-export type PostPrivacy = 'public' | 'private' | 'group'
+export type PostPrivacy = 'public' | 'friends' | 'group' | 'private'
 
 export interface Post {
   post_id: string
@@ -46,7 +46,8 @@ export interface Post {
   visibility: PostPrivacy
   likes_count: number
   comments_count: number
-  user_likes?: string[] // Array of user IDs who liked the post
+  reaction_counts?: Record<string, number> // Number of reactions of each kind
+  viewer_reactions?: string[] // Reaction kinds the current user gave the post
 }
 
 export interface Comment {
@@ -117,6 +118,7 @@ export interface PaginatedResponse<T> {
   page: number
   pageSize: number
   hasMore: boolean
+  next_cursor?: string // Pass back as the cursor query parameter to fetch the next page
 }
 
 // Form related types